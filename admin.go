@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thihxm/Chirpy/internal/auth"
+	"github.com/thihxm/Chirpy/internal/config"
+	"github.com/thihxm/Chirpy/internal/database"
+	"github.com/thihxm/Chirpy/internal/utils"
+)
+
+func middlewareIsAdmin(cfg *config.ApiConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey, err := auth.GetAPIKey(r.Header)
+		if err != nil || cfg.AdminKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.AdminKey)) != 1 {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type WebhookEvent struct {
+	ID          uuid.UUID       `json:"id"`
+	EventID     string          `json:"event_id"`
+	Event       string          `json:"event"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Error       *string         `json:"error"`
+	Attempts    int32           `json:"attempts"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	ProcessedAt *time.Time      `json:"processed_at"`
+}
+
+func newWebhookEvent(event database.WebhookEvent) WebhookEvent {
+	return WebhookEvent{
+		ID:          event.ID,
+		EventID:     event.EventID,
+		Event:       event.Event,
+		Payload:     event.Payload,
+		Status:      event.Status,
+		Error:       nullStringPtr(event.Error),
+		Attempts:    event.Attempts,
+		CreatedAt:   event.CreatedAt,
+		UpdatedAt:   event.UpdatedAt,
+		ProcessedAt: nullTimePtr(event.ProcessedAt),
+	}
+}
+
+type WebhookEventPage struct {
+	Events     []WebhookEvent `json:"events"`
+	NextCursor *string        `json:"next_cursor"`
+}
+
+func listWebhookEventsHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var status sql.NullString
+		if queryStatus := r.URL.Query().Get("status"); queryStatus != "" {
+			status = sql.NullString{String: queryStatus, Valid: true}
+		}
+
+		page, err := parsePageParams(r)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+			return
+		}
+
+		rawEvents, err := cfg.Queries.ListWebhookEvents(r.Context(), database.ListWebhookEventsParams{
+			Status:          status,
+			CursorCreatedAt: page.CursorCreatedAt,
+			CursorID:        page.CursorID,
+			Limit:           page.fetchLimit(),
+		})
+		if err != nil {
+			log.Printf("Error listing webhook events: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		var nextCursor *string
+		if len(rawEvents) > page.Limit {
+			rawEvents = rawEvents[:page.Limit]
+			last := rawEvents[len(rawEvents)-1]
+			cursor := utils.EncodeCursor(last.CreatedAt, last.ID)
+			nextCursor = &cursor
+		}
+
+		events := make([]WebhookEvent, len(rawEvents))
+		for i, event := range rawEvents {
+			events[i] = newWebhookEvent(event)
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, WebhookEventPage{
+			Events:     events,
+			NextCursor: nextCursor,
+		})
+	})
+}
+
+func replayWebhookEventHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("eventID"))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid event ID")
+			return
+		}
+
+		_, err = cfg.Queries.GetWebhookEventByID(r.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "Webhook event not found")
+			return
+		}
+		if err != nil {
+			log.Printf("Error getting webhook event: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		claimed, err := cfg.Queries.ClaimWebhookEvent(r.Context(), database.ClaimWebhookEventParams{
+			ID: id,
+			Statuses: []string{
+				webhookStatusReceived,
+				webhookStatusProcessed,
+				webhookStatusIgnored,
+				webhookStatusFailed,
+			},
+			LeaseSeconds: int32(WEBHOOK_PROCESSING_LEASE.Seconds()),
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusConflict, "Webhook event is already being processed")
+			return
+		}
+		if err != nil {
+			log.Printf("Error claiming webhook event: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		err = runWebhookEvent(r.Context(), cfg, claimed)
+		if err != nil {
+			log.Printf("Error replaying webhook event: %v", err)
+		}
+
+		event, err := cfg.Queries.GetWebhookEventByID(r.Context(), id)
+		if err != nil {
+			log.Printf("Error getting webhook event: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, newWebhookEvent(event))
+	})
+}
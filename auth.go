@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -18,6 +20,8 @@ type contextKey string
 
 const userIDKey contextKey = "userID"
 
+var errTokenInvalidated = errors.New("token was invalidated")
+
 const (
 	DEFAULT_TOKEN_EXPIRATION_TIME = 1 * time.Hour
 	MAX_TOKEN_EXPIRATION_TIME     = 1 * time.Hour
@@ -26,15 +30,25 @@ const (
 
 func middlewareIsAuthenticated(cfg *config.ApiConfig, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token, err := auth.GetBearerToken(r.Header)
+		userID, err := authenticateRequest(r, cfg)
 		if err != nil {
 			utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		userID, err := auth.ValidateJWT(token, cfg.AuthSecret)
+		ctx := context.WithValue(r.Context(), userIDKey, userID)
+		newReq := r.WithContext(ctx)
+		next.ServeHTTP(w, newReq)
+	})
+}
+
+// middlewareOptionalAuthentication behaves like middlewareIsAuthenticated
+// when a valid access token is sent, but lets anonymous requests through.
+func middlewareOptionalAuthentication(cfg *config.ApiConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticateRequest(r, cfg)
 		if err != nil {
-			utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			next.ServeHTTP(w, r)
 			return
 		}
 
@@ -44,14 +58,48 @@ func middlewareIsAuthenticated(cfg *config.ApiConfig, next http.Handler) http.Ha
 	})
 }
 
+// authenticateRequest validates the bearer access token and rejects tokens
+// issued before the user last logged out everywhere.
+func authenticateRequest(r *http.Request, cfg *config.ApiConfig) (uuid.UUID, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	accessToken, err := auth.ParseAccessToken(token, cfg.Keyring)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	validAfter, err := cfg.Queries.GetUserTokensValidAfter(r.Context(), accessToken.UserID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if validAfter.Valid && accessToken.IssuedBefore(validAfter.Time) {
+		return uuid.Nil, errTokenInvalidated
+	}
+
+	return accessToken.UserID, nil
+}
+
+func viewerIDFromContext(ctx context.Context) uuid.NullUUID {
+	userID, ok := ctx.Value(userIDKey).(uuid.UUID)
+	return uuid.NullUUID{UUID: userID, Valid: ok}
+}
+
 type AuthenticatedUser struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	IsChirpyRed  bool      `json:"is_chirpy_red"`
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	PendingEmail  *string   `json:"pending_email"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	Handle        *string   `json:"handle"`
+	DisplayName   string    `json:"display_name"`
+	Bio           string    `json:"bio"`
+	Token         string    `json:"token"`
+	RefreshToken  string    `json:"refresh_token"`
 }
 
 func loginHandler(cfg *config.ApiConfig) http.Handler {
@@ -81,60 +129,139 @@ func loginHandler(cfg *config.ApiConfig) http.Handler {
 			}
 		}
 
-		user, err := cfg.Queries.GetUserByEmail(r.Context(), params.Email)
-		if err != nil {
-			log.Printf("Error getting user: %v", err)
-			utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		attemptKeys := loginAttemptKeys(r, params.Email)
+		if respondIfLoginLocked(w, r, cfg, attemptKeys) {
 			return
 		}
 
-		err = auth.ComparePassword(user.HashedPassword, params.Password)
-		if err != nil {
-			log.Printf("Error comparing password: %v", err)
-			utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		// Every failure gets the same response, so it doesn't tell whether
+		// the email has an account.
+		user, err := cfg.Queries.GetUserByEmail(r.Context(), params.Email)
+		if errors.Is(err, sql.ErrNoRows) {
+			cfg.PasswordHasher.Verify(dummyPasswordHash(cfg), params.Password)
+			utils.RespondWithError(w, http.StatusUnauthorized, LOGIN_FAILED_MESSAGE)
 			return
 		}
-
-		token, err := auth.MakeJWT(user.ID, cfg.AuthSecret, expiresIn)
 		if err != nil {
-			log.Printf("Error generating token: %v", err)
+			log.Printf("Error getting user: %v", err)
 			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
 			return
 		}
 
-		refreshToken, err := auth.MakeRefreshToken()
+		needsRehash, err := cfg.PasswordHasher.Verify(user.HashedPassword, params.Password)
 		if err != nil {
-			log.Printf("Error generating refresh token: %v", err)
-			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			if !errors.Is(err, auth.ErrPasswordMismatch) {
+				log.Printf("Error verifying password: %v", err)
+			}
+			utils.RespondWithError(w, http.StatusUnauthorized, LOGIN_FAILED_MESSAGE)
 			return
 		}
 
-		_, err = cfg.Queries.CreateRefreshToken(
-			r.Context(),
-			database.CreateRefreshTokenParams{
-				Token:     refreshToken,
-				UserID:    user.ID,
-				ExpiresAt: time.Now().Add(REFRESH_TOKEN_EXPIRATION_TIME),
-			},
-		)
-		if err != nil {
-			log.Printf("Error creating refresh token: %v", err)
-			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+		if needsRehash {
+			rehashPassword(r.Context(), cfg, user, params.Password)
+		}
+
+		if user.TotpEnabledAt.Valid {
+			challengeToken, err := auth.MakeChallengeToken(user.ID, cfg.Keyring, TWO_FACTOR_CHALLENGE_EXPIRATION_TIME)
+			if err != nil {
+				log.Printf("Error generating challenge token: %v", err)
+				utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+				return
+			}
+
+			utils.RespondWithJSON(w, http.StatusOK, TwoFactorChallenge{
+				TwoFactorRequired: true,
+				ChallengeToken:    challengeToken,
+			})
 			return
 		}
 
-		utils.RespondWithJSON(w, http.StatusOK, AuthenticatedUser{
-			ID:           user.ID,
-			CreatedAt:    user.CreatedAt,
-			UpdatedAt:    user.UpdatedAt,
-			Email:        user.Email,
-			IsChirpyRed:  user.IsChirpyRed,
-			Token:        token,
-			RefreshToken: refreshToken,
-		})
+		clearLoginFailures(r.Context(), cfg, attemptKeys)
+		respondWithSession(w, r, cfg, user, expiresIn)
 	})
 }
 
+// rehashPassword upgrades a stored hash to the current algorithm and cost.
+// It only runs after a successful login, the one time the plain password is
+// known, and a failure leaves the old hash working. The hash is only replaced
+// if it is still the one that was verified, so a password changed in the
+// meantime isn't overwritten with the old one.
+func rehashPassword(ctx context.Context, cfg *config.ApiConfig, user database.User, password string) {
+	hashedPassword, err := cfg.PasswordHasher.Hash(password)
+	if err != nil {
+		log.Printf("Error rehashing password: %v", err)
+		return
+	}
+
+	err = cfg.Queries.RehashUserPassword(ctx, database.RehashUserPasswordParams{
+		NewHashedPassword: hashedPassword,
+		ID:                user.ID,
+		OldHashedPassword: user.HashedPassword,
+	})
+	if err != nil {
+		log.Printf("Error saving rehashed password: %v", err)
+	}
+}
+
+// respondWithSession starts a new session for a user who has passed every
+// login factor.
+func respondWithSession(w http.ResponseWriter, r *http.Request, cfg *config.ApiConfig, user database.User, expiresIn time.Duration) {
+	token, err := auth.MakeJWT(user.ID, cfg.Keyring, expiresIn)
+	if err != nil {
+		log.Printf("Error generating token: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	refreshToken, err := issueRefreshToken(r, cfg, user.ID, uuid.New())
+	if err != nil {
+		log.Printf("Error creating refresh token: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, AuthenticatedUser{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail:  nullStringPtr(user.PendingEmail),
+		IsChirpyRed:   user.IsChirpyRed,
+		Handle:        nullStringPtr(user.Handle),
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		Token:         token,
+		RefreshToken:  refreshToken,
+	})
+}
+
+// issueRefreshToken creates and stores a refresh token. Tokens rotated from
+// the same login share a familyID so a stolen token can revoke them all.
+func issueRefreshToken(r *http.Request, cfg *config.ApiConfig, userID, familyID uuid.UUID) (string, error) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = cfg.Queries.CreateRefreshToken(
+		r.Context(),
+		database.CreateRefreshTokenParams{
+			TokenHash: auth.HashRefreshToken(refreshToken),
+			UserID:    userID,
+			ExpiresAt: time.Now().Add(REFRESH_TOKEN_EXPIRATION_TIME),
+			FamilyID:  familyID,
+			UserAgent: r.UserAgent(),
+			IpAddress: clientIP(r),
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
 func refreshHandler(cfg *config.ApiConfig) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		headerRefreshToken, err := auth.GetBearerToken(r.Header)
@@ -143,13 +270,35 @@ func refreshHandler(cfg *config.ApiConfig) http.Handler {
 			return
 		}
 
-		refreshToken, err := cfg.Queries.GetRefreshTokenByToken(r.Context(), headerRefreshToken)
-		if err != nil {
+		refreshToken, err := cfg.Queries.ConsumeRefreshToken(r.Context(), auth.HashRefreshToken(headerRefreshToken))
+		if errors.Is(err, sql.ErrNoRows) {
+			// A revoked token being presented again means it was copied. Revoke
+			// every token issued from the same login.
+			reused, findErr := cfg.Queries.FindRefreshToken(r.Context(), auth.HashRefreshToken(headerRefreshToken))
+			if findErr == nil && reused.RevokedAt.Valid {
+				log.Printf("Refresh token reuse detected for user %s", reused.UserID)
+				err = cfg.Queries.RevokeRefreshTokenFamily(r.Context(), reused.FamilyID)
+				if err != nil {
+					log.Printf("Error revoking refresh token family: %v", err)
+				}
+			}
 			utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
+		if err != nil {
+			log.Printf("Error consuming refresh token: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		newRefreshToken, err := issueRefreshToken(r, cfg, refreshToken.UserID, refreshToken.FamilyID)
+		if err != nil {
+			log.Printf("Error creating refresh token: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
 
-		token, err := auth.MakeJWT(refreshToken.UserID, cfg.AuthSecret, DEFAULT_TOKEN_EXPIRATION_TIME)
+		token, err := auth.MakeJWT(refreshToken.UserID, cfg.Keyring, DEFAULT_TOKEN_EXPIRATION_TIME)
 		if err != nil {
 			log.Printf("Error generating token: %v", err)
 			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
@@ -157,10 +306,14 @@ func refreshHandler(cfg *config.ApiConfig) http.Handler {
 		}
 
 		type resToken struct {
-			Token string `json:"token"`
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
 		}
 
-		utils.RespondWithJSON(w, http.StatusOK, resToken{Token: token})
+		utils.RespondWithJSON(w, http.StatusOK, resToken{
+			Token:        token,
+			RefreshToken: newRefreshToken,
+		})
 	})
 }
 
@@ -172,7 +325,7 @@ func revokeHandler(cfg *config.ApiConfig) http.Handler {
 			return
 		}
 
-		_, err = cfg.Queries.RevokeRefreshToken(r.Context(), refreshToken)
+		_, err = cfg.Queries.RevokeRefreshToken(r.Context(), auth.HashRefreshToken(refreshToken))
 		if err != nil {
 			utils.RespondWithError(w, http.StatusNotFound, "Refresh token not found")
 			return
@@ -181,3 +334,12 @@ func revokeHandler(cfg *config.ApiConfig) http.Handler {
 		utils.RespondWithJSON(w, http.StatusNoContent, nil)
 	})
 }
+
+// jwksHandler publishes the public keys access tokens are signed with, so
+// other services can verify them without calling Chirpy.
+func jwksHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		utils.RespondWithJSON(w, http.StatusOK, cfg.Keyring.JWKS())
+	})
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,21 +17,183 @@ import (
 )
 
 const (
-	MaxChirpLength = 140
+	MAX_THREAD_DEPTH       = 50
+	MAX_THREAD_DESCENDANTS = 500
+	MAX_SEARCH_OFFSET      = 1000
 )
 
+var errEditWindowExpired = errors.New("edit window has expired")
+
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID        uuid.UUID      `json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	Body      string         `json:"body"`
+	UserID    uuid.UUID      `json:"user_id"`
+	InReplyTo *uuid.UUID     `json:"in_reply_to"`
+	DeletedAt *time.Time     `json:"deleted_at,omitempty"`
+	Mentions  []ChirpMention `json:"mentions"`
+	LikeCount int64          `json:"like_count"`
+	LikedByMe bool           `json:"liked_by_me"`
+	RechirpOf *uuid.UUID     `json:"rechirp_of"`
+	QuoteOf   *uuid.UUID     `json:"quote_of"`
+
+	RechirpedChirp *Chirp `json:"rechirped_chirp,omitempty"`
+	QuotedChirp    *Chirp `json:"quoted_chirp,omitempty"`
+}
+
+func newChirp(chirp database.Chirp) Chirp {
+	return Chirp{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+		InReplyTo: nullUUIDPtr(chirp.InReplyTo),
+		DeletedAt: nullTimePtr(chirp.DeletedAt),
+		RechirpOf: nullUUIDPtr(chirp.RechirpOf),
+		QuoteOf:   nullUUIDPtr(chirp.QuoteOf),
+	}
+}
+
+func newThreadChirp(chirp database.GetChirpDescendantsRow) Chirp {
+	return Chirp{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+		InReplyTo: nullUUIDPtr(chirp.InReplyTo),
+		DeletedAt: nullTimePtr(chirp.DeletedAt),
+		RechirpOf: nullUUIDPtr(chirp.RechirpOf),
+		QuoteOf:   nullUUIDPtr(chirp.QuoteOf),
+	}
+}
+
+// hydrateChirps embeds the chirps referenced by rechirps and quotes and loads
+// mentions and like stats for everything in the response.
+func hydrateChirps(r *http.Request, cfg *config.ApiConfig, chirps []Chirp) error {
+	refIDs := []uuid.UUID{}
+	for _, chirp := range chirps {
+		if chirp.RechirpOf != nil {
+			refIDs = append(refIDs, *chirp.RechirpOf)
+		}
+		if chirp.QuoteOf != nil {
+			refIDs = append(refIDs, *chirp.QuoteOf)
+		}
+	}
+
+	if len(refIDs) > 0 {
+		rawRefs, err := cfg.Queries.GetChirpsByIDs(r.Context(), refIDs)
+		if err != nil {
+			return err
+		}
+
+		refs := make([]Chirp, len(rawRefs))
+		for i, ref := range rawRefs {
+			refs[i] = newChirp(ref)
+		}
+		err = withMentions(r, cfg, refs)
+		if err != nil {
+			return err
+		}
+		err = withLikeStats(r, cfg, refs)
+		if err != nil {
+			return err
+		}
+
+		refsByID := make(map[uuid.UUID]*Chirp, len(refs))
+		for i := range refs {
+			refsByID[refs[i].ID] = &refs[i]
+		}
+
+		for i := range chirps {
+			if chirps[i].RechirpOf != nil {
+				chirps[i].RechirpedChirp = refsByID[*chirps[i].RechirpOf]
+			}
+			if chirps[i].QuoteOf != nil {
+				chirps[i].QuotedChirp = refsByID[*chirps[i].QuoteOf]
+			}
+		}
+	}
+
+	err := withMentions(r, cfg, chirps)
+	if err != nil {
+		return err
+	}
+
+	return withLikeStats(r, cfg, chirps)
+}
+
+// replaceChirpEntities drops the hashtags and mentions of an edited chirp and
+// parses them again from the new body.
+func replaceChirpEntities(r *http.Request, queries *database.Queries, chirp database.Chirp) error {
+	err := queries.DeleteChirpHashtags(r.Context(), chirp.ID)
+	if err != nil {
+		return err
+	}
+
+	err = queries.DeleteChirpMentions(r.Context(), chirp.ID)
+	if err != nil {
+		return err
+	}
+
+	return saveChirpEntities(r, queries, chirp)
+}
+
+// saveChirpEntities stores the hashtags and mentions parsed from the chirp
+// body. It runs in the transaction that writes the chirp, so a chirp is never
+// missing from the hashtag and mention feeds.
+func saveChirpEntities(r *http.Request, queries *database.Queries, chirp database.Chirp) error {
+	err := saveChirpHashtags(r, queries, chirp)
+	if err != nil {
+		return err
+	}
+
+	return saveChirpMentions(r, queries, chirp)
+}
+
+// getRepostTarget loads the chirp a rechirp or quote should point to. Rechirps
+// of rechirps are resolved to the original chirp.
+func getRepostTarget(r *http.Request, cfg *config.ApiConfig, id uuid.UUID) (database.Chirp, error) {
+	chirp, err := cfg.Queries.GetChirpByID(r.Context(), id)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+
+	if chirp.RechirpOf.Valid {
+		chirp, err = cfg.Queries.GetChirpByID(r.Context(), chirp.RechirpOf.UUID)
+		if err != nil {
+			return database.Chirp{}, err
+		}
+	}
+
+	if chirp.DeletedAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+
+	return chirp, nil
+}
+
+func nullUUIDPtr(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
 }
 
 func createChirpHandler(cfg *config.ApiConfig) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		type parameters struct {
-			Body string `json:"body"`
+			Body      string     `json:"body"`
+			InReplyTo *uuid.UUID `json:"in_reply_to"`
 		}
 
 		decoder := json.NewDecoder(r.Body)
@@ -39,27 +205,353 @@ func createChirpHandler(cfg *config.ApiConfig) http.Handler {
 			return
 		}
 
-		if len(params.Body) > MaxChirpLength {
+		userID := r.Context().Value(userIDKey).(uuid.UUID)
+
+		userEntitlements, err := getUserEntitlements(r, cfg, userID)
+		if err != nil {
+			log.Printf("Error getting entitlements: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		if userEntitlements.ChirpTooLong(params.Body) {
 			utils.RespondWithError(w, http.StatusBadRequest, "Chirp is too long")
 			return
 		}
 
+		var inReplyTo uuid.NullUUID
+		if params.InReplyTo != nil {
+			parent, err := cfg.Queries.GetChirpByID(r.Context(), *params.InReplyTo)
+			if err != nil || parent.DeletedAt.Valid {
+				utils.RespondWithError(w, http.StatusNotFound, "Parent chirp not found")
+				return
+			}
+			inReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		}
+
+		var chirp database.Chirp
+		err = cfg.InTx(r.Context(), func(queries *database.Queries) error {
+			var err error
+			chirp, err = queries.CreateChirp(r.Context(), database.CreateChirpParams{
+				Body:      utils.RemoveProfanity(params.Body),
+				UserID:    userID,
+				InReplyTo: inReplyTo,
+			})
+			if err != nil {
+				return err
+			}
+			return saveChirpEntities(r, queries, chirp)
+		})
+		if isForeignKeyViolation(err, "chirps_in_reply_to_fkey") {
+			utils.RespondWithError(w, http.StatusNotFound, "Parent chirp not found")
+			return
+		}
+		if err != nil {
+			log.Printf("Error creating chirp: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		chirps := []Chirp{newChirp(chirp)}
+		err = hydrateChirps(r, cfg, chirps)
+		if err != nil {
+			log.Printf("Error loading chirp details: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusCreated, chirps[0])
+	})
+}
+
+func updateChirpHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type parameters struct {
+			Body string `json:"body"`
+		}
+
+		rawID := r.PathValue("chirpID")
+
+		id, err := uuid.Parse(rawID)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err = decoder.Decode(&params)
+		if err != nil {
+			log.Printf("Error decoding parameters: %v", err)
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request")
+			return
+		}
+
 		userID := r.Context().Value(userIDKey).(uuid.UUID)
 
-		chirp, err := cfg.Queries.CreateChirp(r.Context(), database.CreateChirpParams{
-			Body:   utils.RemoveProfanity(params.Body),
-			UserID: userID,
+		userEntitlements, err := getUserEntitlements(r, cfg, userID)
+		if err != nil {
+			log.Printf("Error getting entitlements: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		if userEntitlements.ChirpTooLong(params.Body) {
+			utils.RespondWithError(w, http.StatusBadRequest, "Chirp is too long")
+			return
+		}
+
+		existing, err := cfg.Queries.GetChirpByID(r.Context(), id)
+		if err != nil || existing.DeletedAt.Valid {
+			utils.RespondWithError(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+
+		if existing.UserID != userID {
+			utils.RespondWithError(w, http.StatusForbidden, "This chirp does not belong to you")
+			return
+		}
+
+		if existing.RechirpOf.Valid {
+			utils.RespondWithError(w, http.StatusBadRequest, "Rechirps cannot be edited")
+			return
+		}
+
+		if !userEntitlements.CanEditChirps() {
+			utils.RespondWithError(w, http.StatusForbidden, "Your plan can't edit chirps")
+			return
+		}
+
+		// The edit window is checked by the update itself against the
+		// database clock, so an edit can't commit after the window closes.
+		var chirp database.Chirp
+		err = cfg.InTx(r.Context(), func(queries *database.Queries) error {
+			var err error
+			chirp, err = queries.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+				ID:                id,
+				UserID:            userID,
+				EditWindowSeconds: int32(userEntitlements.EditWindow.Seconds()),
+				Body:              utils.RemoveProfanity(params.Body),
+			})
+			if errors.Is(err, sql.ErrNoRows) {
+				// No row was updated either because the window closed or
+				// because the chirp was deleted in the meantime.
+				current, err := queries.GetChirpByID(r.Context(), id)
+				if err != nil || current.DeletedAt.Valid {
+					return sql.ErrNoRows
+				}
+				return errEditWindowExpired
+			}
+			if err != nil {
+				return err
+			}
+			return replaceChirpEntities(r, queries, chirp)
+		})
+		if errors.Is(err, errEditWindowExpired) {
+			utils.RespondWithError(w, http.StatusForbidden, "Edit window has expired")
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+		if err != nil {
+			log.Printf("Error updating chirp: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		chirps := []Chirp{newChirp(chirp)}
+		err = hydrateChirps(r, cfg, chirps)
+		if err != nil {
+			log.Printf("Error loading chirp details: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, chirps[0])
+	})
+}
+
+func createRechirpHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawID := r.PathValue("chirpID")
+
+		id, err := uuid.Parse(rawID)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+			return
+		}
+
+		original, err := getRepostTarget(r, cfg, id)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+
+		userID := r.Context().Value(userIDKey).(uuid.UUID)
+
+		chirp, err := cfg.Queries.CreateRechirp(r.Context(), database.CreateRechirpParams{
+			UserID:    userID,
+			RechirpOf: uuid.NullUUID{UUID: original.ID, Valid: true},
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusConflict, "Chirp already rechirped")
+			return
+		}
+		if err != nil {
+			log.Printf("Error creating rechirp: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		chirps := []Chirp{newChirp(chirp)}
+		err = hydrateChirps(r, cfg, chirps)
+		if err != nil {
+			log.Printf("Error loading chirp details: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusCreated, chirps[0])
+	})
+}
+
+func deleteRechirpHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawID := r.PathValue("chirpID")
+
+		id, err := uuid.Parse(rawID)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+			return
+		}
+
+		userID := r.Context().Value(userIDKey).(uuid.UUID)
+
+		deleted, err := cfg.Queries.DeleteRechirp(r.Context(), database.DeleteRechirpParams{
+			UserID:    userID,
+			RechirpOf: uuid.NullUUID{UUID: id, Valid: true},
 		})
 		if err != nil {
-			log.Printf("Error creating user: %v", err)
+			log.Printf("Error deleting rechirp: %v", err)
 			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
 			return
 		}
+		if deleted == 0 {
+			utils.RespondWithError(w, http.StatusNotFound, "Rechirp not found")
+			return
+		}
 
-		utils.RespondWithJSON(w, http.StatusCreated, Chirp(chirp))
+		utils.RespondWithJSON(w, http.StatusNoContent, nil)
 	})
 }
 
+func createQuoteChirpHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type parameters struct {
+			Body string `json:"body"`
+		}
+
+		rawID := r.PathValue("chirpID")
+
+		id, err := uuid.Parse(rawID)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err = decoder.Decode(&params)
+		if err != nil {
+			log.Printf("Error decoding parameters: %v", err)
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request")
+			return
+		}
+
+		// Without a body of its own a quote is just a rechirp.
+		if strings.TrimSpace(params.Body) == "" {
+			utils.RespondWithError(w, http.StatusBadRequest, "Quote chirps need a body")
+			return
+		}
+
+		userID := r.Context().Value(userIDKey).(uuid.UUID)
+
+		userEntitlements, err := getUserEntitlements(r, cfg, userID)
+		if err != nil {
+			log.Printf("Error getting entitlements: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		if userEntitlements.ChirpTooLong(params.Body) {
+			utils.RespondWithError(w, http.StatusBadRequest, "Chirp is too long")
+			return
+		}
+
+		original, err := getRepostTarget(r, cfg, id)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+
+		var chirp database.Chirp
+		err = cfg.InTx(r.Context(), func(queries *database.Queries) error {
+			var err error
+			chirp, err = queries.CreateQuoteChirp(r.Context(), database.CreateQuoteChirpParams{
+				Body:    utils.RemoveProfanity(params.Body),
+				UserID:  userID,
+				QuoteOf: uuid.NullUUID{UUID: original.ID, Valid: true},
+			})
+			if err != nil {
+				return err
+			}
+			return saveChirpEntities(r, queries, chirp)
+		})
+		if err != nil {
+			log.Printf("Error creating quote chirp: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		chirps := []Chirp{newChirp(chirp)}
+		err = hydrateChirps(r, cfg, chirps)
+		if err != nil {
+			log.Printf("Error loading chirp details: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusCreated, chirps[0])
+	})
+}
+
+type ChirpPage struct {
+	Chirps     []Chirp `json:"chirps"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+func newChirpPage(rawChirps []database.Chirp, limit int) ChirpPage {
+	var nextCursor *string
+	if len(rawChirps) > limit {
+		rawChirps = rawChirps[:limit]
+		last := rawChirps[len(rawChirps)-1]
+		cursor := utils.EncodeCursor(last.CreatedAt, last.ID)
+		nextCursor = &cursor
+	}
+
+	chirps := make([]Chirp, len(rawChirps))
+	for i, chirp := range rawChirps {
+		chirps[i] = newChirp(chirp)
+	}
+
+	return ChirpPage{
+		Chirps:     chirps,
+		NextCursor: nextCursor,
+	}
+}
+
 func getChirpsHandler(cfg *config.ApiConfig) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		queryAuthorID := r.URL.Query().Get("author_id")
@@ -67,6 +559,7 @@ func getChirpsHandler(cfg *config.ApiConfig) http.Handler {
 
 		if querySort != "" && querySort != "asc" && querySort != "desc" {
 			utils.RespondWithError(w, http.StatusBadRequest, "Invalid sort parameter")
+			return
 		}
 		if querySort == "" {
 			querySort = "asc"
@@ -81,20 +574,114 @@ func getChirpsHandler(cfg *config.ApiConfig) http.Handler {
 			}
 			authorID = uuid.NullUUID{UUID: parsedUUID, Valid: true}
 		}
-		rawChirps, err := cfg.Queries.GetChirps(r.Context(), database.GetChirpsParams{
-			AuthorID: authorID,
-			Sort:     querySort,
-		})
 
+		page, err := parsePageParams(r)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+			return
+		}
+
+		var rawChirps []database.Chirp
+		if querySort == "desc" {
+			rawChirps, err = cfg.Queries.GetChirpsBefore(r.Context(), database.GetChirpsBeforeParams{
+				AuthorID:        authorID,
+				CursorCreatedAt: page.CursorCreatedAt,
+				CursorID:        page.CursorID,
+				Limit:           page.fetchLimit(),
+			})
+		} else {
+			rawChirps, err = cfg.Queries.GetChirpsAfter(r.Context(), database.GetChirpsAfterParams{
+				AuthorID:        authorID,
+				CursorCreatedAt: page.CursorCreatedAt,
+				CursorID:        page.CursorID,
+				Limit:           page.fetchLimit(),
+			})
+		}
 		if err != nil {
 			log.Printf("Error getting chirps: %v", err)
 			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
 			return
 		}
 
-		chirps := make([]Chirp, len(rawChirps))
-		for i, chirp := range rawChirps {
-			chirps[i] = Chirp(chirp)
+		chirpPage := newChirpPage(rawChirps, page.Limit)
+		err = hydrateChirps(r, cfg, chirpPage.Chirps)
+		if err != nil {
+			log.Printf("Error loading chirp details: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		// Clients have always received a bare array here, so the next page
+		// goes in a header instead of wrapping the body.
+		setNextPageLink(w, r, chirpPage.NextCursor)
+		utils.RespondWithJSON(w, http.StatusOK, chirpPage.Chirps)
+	})
+}
+
+func searchChirpsHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queryAuthorID := r.URL.Query().Get("author_id")
+
+		tsQuery, err := utils.BuildTSQuery(r.URL.Query().Get("q"))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid search query")
+			return
+		}
+
+		var authorID uuid.NullUUID
+		if queryAuthorID != "" {
+			parsedUUID, err := uuid.Parse(queryAuthorID)
+			if err != nil {
+				utils.RespondWithError(w, http.StatusBadRequest, "Invalid author ID")
+				return
+			}
+			authorID = uuid.NullUUID{UUID: parsedUUID, Valid: true}
+		}
+
+		// Results are ordered by rank, which a created_at cursor can't page
+		// through, so search pages by offset instead.
+		if r.URL.Query().Has("cursor") {
+			utils.RespondWithError(w, http.StatusBadRequest, "Search results are paged with offset, not cursor")
+			return
+		}
+
+		page, err := parsePageParams(r)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+			return
+		}
+
+		offset := 0
+		if rawOffset := r.URL.Query().Get("offset"); rawOffset != "" {
+			offset, err = strconv.Atoi(rawOffset)
+			if err != nil || offset < 0 || offset > MAX_SEARCH_OFFSET {
+				utils.RespondWithError(w, http.StatusBadRequest, "Invalid offset parameter")
+				return
+			}
+		}
+
+		results, err := cfg.Queries.SearchChirps(r.Context(), database.SearchChirpsParams{
+			Query:    tsQuery,
+			AuthorID: authorID,
+			Limit:    int32(page.Limit),
+			Offset:   int32(offset),
+		})
+		if err != nil {
+			log.Printf("Error searching chirps: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		chirps := make([]Chirp, len(results))
+		for i, result := range results {
+			chirps[i] = newChirp(result)
+		}
+
+		err = hydrateChirps(r, cfg, chirps)
+		if err != nil {
+			log.Printf("Error loading chirp details: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
 		}
 
 		utils.RespondWithJSON(w, http.StatusOK, chirps)
@@ -117,7 +704,129 @@ func getChirpByIDHandler(cfg *config.ApiConfig) http.Handler {
 			return
 		}
 
-		utils.RespondWithJSON(w, http.StatusOK, Chirp(chirp))
+		chirps := []Chirp{newChirp(chirp)}
+		err = hydrateChirps(r, cfg, chirps)
+		if err != nil {
+			log.Printf("Error loading chirp details: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, chirps[0])
+	})
+}
+
+func getChirpRepliesHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawID := r.PathValue("chirpID")
+
+		id, err := uuid.Parse(rawID)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+			return
+		}
+
+		page, err := parsePageParams(r)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+			return
+		}
+
+		_, err = cfg.Queries.GetChirpByID(r.Context(), id)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+
+		rawChirps, err := cfg.Queries.GetChirpReplies(r.Context(), database.GetChirpRepliesParams{
+			ChirpID:         id,
+			CursorCreatedAt: page.CursorCreatedAt,
+			CursorID:        page.CursorID,
+			Limit:           page.fetchLimit(),
+		})
+		if err != nil {
+			log.Printf("Error getting chirp replies: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		chirpPage := newChirpPage(rawChirps, page.Limit)
+		err = hydrateChirps(r, cfg, chirpPage.Chirps)
+		if err != nil {
+			log.Printf("Error loading chirp details: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, chirpPage)
+	})
+}
+
+type ChirpThread struct {
+	Ancestors   []Chirp `json:"ancestors"`
+	Chirp       Chirp   `json:"chirp"`
+	Descendants []Chirp `json:"descendants"`
+}
+
+func getChirpThreadHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawID := r.PathValue("chirpID")
+
+		id, err := uuid.Parse(rawID)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+			return
+		}
+
+		chirp, err := cfg.Queries.GetChirpByID(r.Context(), id)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+
+		rawAncestors, err := cfg.Queries.GetChirpAncestors(r.Context(), database.GetChirpAncestorsParams{
+			ChirpID:  id,
+			MaxDepth: MAX_THREAD_DEPTH,
+		})
+		if err != nil {
+			log.Printf("Error getting chirp ancestors: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		rawDescendants, err := cfg.Queries.GetChirpDescendants(r.Context(), database.GetChirpDescendantsParams{
+			ChirpID:  id,
+			MaxDepth: MAX_THREAD_DEPTH,
+			Limit:    MAX_THREAD_DESCENDANTS,
+		})
+		if err != nil {
+			log.Printf("Error getting chirp descendants: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		// Load like stats for the whole thread in one go, then split it back up.
+		chirps := make([]Chirp, 0, len(rawAncestors)+1+len(rawDescendants))
+		for _, ancestor := range rawAncestors {
+			chirps = append(chirps, newThreadChirp(database.GetChirpDescendantsRow(ancestor)))
+		}
+		chirps = append(chirps, newChirp(chirp))
+		for _, descendant := range rawDescendants {
+			chirps = append(chirps, newThreadChirp(descendant))
+		}
+
+		err = hydrateChirps(r, cfg, chirps)
+		if err != nil {
+			log.Printf("Error loading chirp details: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, ChirpThread{
+			Ancestors:   chirps[:len(rawAncestors)],
+			Chirp:       chirps[len(rawAncestors)],
+			Descendants: chirps[len(rawAncestors)+1:],
+		})
 	})
 }
 
@@ -134,7 +843,7 @@ func deleteChirpByIDHandler(cfg *config.ApiConfig) http.Handler {
 		userID := r.Context().Value(userIDKey).(uuid.UUID)
 
 		chirp, err := cfg.Queries.GetChirpByID(r.Context(), id)
-		if err != nil {
+		if err != nil || chirp.DeletedAt.Valid {
 			utils.RespondWithError(w, http.StatusNotFound, "Chirp not found")
 			return
 		}
@@ -144,11 +853,53 @@ func deleteChirpByIDHandler(cfg *config.ApiConfig) http.Handler {
 			return
 		}
 
-		err = cfg.Queries.DeleteChirpByID(r.Context(), database.DeleteChirpByIDParams{
-			ID:     id,
-			UserID: userID,
+		// Chirps with replies are kept as tombstones so the thread below them
+		// stays reachable. Tombstoning also deletes the chirp's revisions, so
+		// its text can't be recovered from the edit history. The chirp is
+		// locked first, so a reply can't be added between the check and the
+		// delete and lose its parent.
+		err = cfg.InTx(r.Context(), func(queries *database.Queries) error {
+			_, err := queries.LockChirpByID(r.Context(), database.LockChirpByIDParams{
+				ID:     id,
+				UserID: userID,
+			})
+			if err != nil {
+				return err
+			}
+
+			hasReplies, err := queries.HasChirpReplies(r.Context(), uuid.NullUUID{UUID: id, Valid: true})
+			if err != nil {
+				return err
+			}
+
+			if !hasReplies {
+				return queries.DeleteChirpByID(r.Context(), database.DeleteChirpByIDParams{
+					ID:     id,
+					UserID: userID,
+				})
+			}
+
+			err = queries.TombstoneChirpByID(r.Context(), database.TombstoneChirpByIDParams{
+				ID:     id,
+				UserID: userID,
+			})
+			if err != nil {
+				return err
+			}
+
+			err = queries.DeleteChirpHashtags(r.Context(), id)
+			if err != nil {
+				return err
+			}
+
+			return queries.DeleteChirpMentions(r.Context(), id)
 		})
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
 		if err != nil {
+			log.Printf("Error deleting chirp: %v", err)
 			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
 			return
 		}
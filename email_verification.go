@@ -0,0 +1,167 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thihxm/Chirpy/internal/auth"
+	"github.com/thihxm/Chirpy/internal/config"
+	"github.com/thihxm/Chirpy/internal/database"
+	"github.com/thihxm/Chirpy/internal/mailer"
+	"github.com/thihxm/Chirpy/internal/utils"
+)
+
+const EMAIL_VERIFICATION_TOKEN_EXPIRATION_TIME = 24 * time.Hour
+
+// sendEmailVerification mails a confirmation link for email, which is either
+// the user's current address or the one they are switching to.
+func sendEmailVerification(r *http.Request, cfg *config.ApiConfig, userID uuid.UUID, email string) error {
+	verificationToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	_, err = cfg.Queries.CreateEmailVerificationToken(r.Context(), database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashRefreshToken(verificationToken),
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: time.Now().Add(EMAIL_VERIFICATION_TOKEN_EXPIRATION_TIME),
+	})
+	if err != nil {
+		return err
+	}
+
+	verifyURL := cfg.AppURL + "/app/verify-email?token=" + url.QueryEscape(verificationToken)
+	sendMailInBackground(cfg, mailer.Message{
+		To:      email,
+		Subject: "Confirm your email address for Chirpy",
+		Body: fmt.Sprintf(
+			"Confirm that %s belongs to you by opening this link within %d hours:\n%s\n\n"+
+				"If you didn't sign up for Chirpy, you can ignore this email.\n",
+			email, int(EMAIL_VERIFICATION_TOKEN_EXPIRATION_TIME.Hours()), verifyURL,
+		),
+	})
+	return nil
+}
+
+// middlewareIsVerified only lets users with a confirmed email address
+// through. It has to run after middlewareIsAuthenticated.
+func middlewareIsVerified(cfg *config.ApiConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value(userIDKey).(uuid.UUID)
+
+		user, err := cfg.Queries.GetUserByID(r.Context(), userID)
+		if err != nil {
+			log.Printf("Error getting user: %v", err)
+			utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		if !user.EmailVerifiedAt.Valid {
+			utils.RespondWithError(w, http.StatusForbidden, "Email address is not verified")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func verifyEmailHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type parameters struct {
+			Token string `json:"token"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			log.Printf("Error decoding parameters: %v", err)
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request")
+			return
+		}
+
+		verificationToken, err := cfg.Queries.ConsumeEmailVerificationToken(r.Context(), auth.HashRefreshToken(params.Token))
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid or expired verification token")
+			return
+		}
+		if err != nil {
+			log.Printf("Error consuming verification token: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		// The token only counts while its address is still the user's email
+		// or the one they are switching to.
+		user, err := cfg.Queries.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+			Email: verificationToken.Email,
+			ID:    verificationToken.UserID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid or expired verification token")
+			return
+		}
+		if isUniqueViolation(err, "users_email_key") {
+			utils.RespondWithError(w, http.StatusConflict, "Email already in use")
+			return
+		}
+		if err != nil {
+			log.Printf("Error verifying email: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, newUser(user))
+	})
+}
+
+func resendEmailVerificationHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value(userIDKey).(uuid.UUID)
+
+		user, err := cfg.Queries.GetUserByID(r.Context(), userID)
+		if err != nil {
+			log.Printf("Error getting user: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		email := user.Email
+		if user.PendingEmail.Valid {
+			email = user.PendingEmail.String
+
+			// A pending address someone else has taken is answered like any
+			// other, but never gets a link.
+			_, err = cfg.Queries.GetUserByEmail(r.Context(), email)
+			if err == nil {
+				utils.RespondWithJSON(w, http.StatusNoContent, nil)
+				return
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("Error getting user: %v", err)
+				utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+				return
+			}
+		} else if user.EmailVerifiedAt.Valid {
+			utils.RespondWithError(w, http.StatusConflict, "Email address is already verified")
+			return
+		}
+
+		err = sendEmailVerification(r, cfg, user.ID, email)
+		if err != nil {
+			log.Printf("Error sending email verification: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusNoContent, nil)
+	})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thihxm/Chirpy/internal/config"
+	"github.com/thihxm/Chirpy/internal/entitlements"
+	"github.com/thihxm/Chirpy/internal/utils"
+)
+
+type Entitlements struct {
+	Plan              entitlements.Plan `json:"plan"`
+	MaxChirpLength    int               `json:"max_chirp_length"`
+	CanEditChirps     bool              `json:"can_edit_chirps"`
+	EditWindowSeconds int               `json:"edit_window_seconds"`
+}
+
+func getUserEntitlements(r *http.Request, cfg *config.ApiConfig, userID uuid.UUID) (entitlements.Entitlements, error) {
+	user, err := cfg.Queries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		return entitlements.Entitlements{}, err
+	}
+	return entitlements.ForUser(hasChirpyRed(user, time.Now())), nil
+}
+
+func getMyEntitlementsHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value(userIDKey).(uuid.UUID)
+
+		userEntitlements, err := getUserEntitlements(r, cfg, userID)
+		if err != nil {
+			log.Printf("Error getting entitlements: %v", err)
+			utils.RespondWithError(w, http.StatusNotFound, "User not found")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, Entitlements{
+			Plan:              userEntitlements.Plan,
+			MaxChirpLength:    userEntitlements.MaxChirpLength,
+			CanEditChirps:     userEntitlements.CanEditChirps(),
+			EditWindowSeconds: int(userEntitlements.EditWindow.Seconds()),
+		})
+	})
+}
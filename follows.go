@@ -0,0 +1,206 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thihxm/Chirpy/internal/config"
+	"github.com/thihxm/Chirpy/internal/database"
+	"github.com/thihxm/Chirpy/internal/utils"
+)
+
+type FollowedUser struct {
+	ID         uuid.UUID `json:"id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type FollowPage struct {
+	Users      []FollowedUser `json:"users"`
+	NextCursor *string        `json:"next_cursor"`
+}
+
+func newFollowPage(rawUsers []FollowedUser, limit int) FollowPage {
+	var nextCursor *string
+	if len(rawUsers) > limit {
+		rawUsers = rawUsers[:limit]
+		last := rawUsers[len(rawUsers)-1]
+		cursor := utils.EncodeCursor(last.FollowedAt, last.ID)
+		nextCursor = &cursor
+	}
+
+	return FollowPage{
+		Users:      rawUsers,
+		NextCursor: nextCursor,
+	}
+}
+
+func followUserHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		followeeID, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		userID := r.Context().Value(userIDKey).(uuid.UUID)
+		if followeeID == userID {
+			utils.RespondWithError(w, http.StatusBadRequest, "You cannot follow yourself")
+			return
+		}
+
+		_, err = cfg.Queries.GetUserByID(r.Context(), followeeID)
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		if err != nil {
+			log.Printf("Error getting user: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		err = cfg.Queries.FollowUser(r.Context(), database.FollowUserParams{
+			FollowerID: userID,
+			FolloweeID: followeeID,
+		})
+		if err != nil {
+			log.Printf("Error following user: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusNoContent, nil)
+	})
+}
+
+func unfollowUserHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		followeeID, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		userID := r.Context().Value(userIDKey).(uuid.UUID)
+
+		err = cfg.Queries.UnfollowUser(r.Context(), database.UnfollowUserParams{
+			FollowerID: userID,
+			FolloweeID: followeeID,
+		})
+		if err != nil {
+			log.Printf("Error unfollowing user: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusNoContent, nil)
+	})
+}
+
+func getFollowersHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		page, err := parsePageParams(r)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+			return
+		}
+
+		rows, err := cfg.Queries.GetFollowers(r.Context(), database.GetFollowersParams{
+			UserID:          userID,
+			CursorCreatedAt: page.CursorCreatedAt,
+			CursorID:        page.CursorID,
+			Limit:           page.fetchLimit(),
+		})
+		if err != nil {
+			log.Printf("Error getting followers: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		users := make([]FollowedUser, len(rows))
+		for i, row := range rows {
+			users[i] = FollowedUser{ID: row.UserID, FollowedAt: row.CreatedAt}
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, newFollowPage(users, page.Limit))
+	})
+}
+
+func getFollowingHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		page, err := parsePageParams(r)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+			return
+		}
+
+		rows, err := cfg.Queries.GetFollowing(r.Context(), database.GetFollowingParams{
+			UserID:          userID,
+			CursorCreatedAt: page.CursorCreatedAt,
+			CursorID:        page.CursorID,
+			Limit:           page.fetchLimit(),
+		})
+		if err != nil {
+			log.Printf("Error getting followed users: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		users := make([]FollowedUser, len(rows))
+		for i, row := range rows {
+			users[i] = FollowedUser{ID: row.UserID, FollowedAt: row.CreatedAt}
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, newFollowPage(users, page.Limit))
+	})
+}
+
+func getTimelineHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, err := parsePageParams(r)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+			return
+		}
+
+		userID := r.Context().Value(userIDKey).(uuid.UUID)
+
+		rawChirps, err := cfg.Queries.GetTimeline(r.Context(), database.GetTimelineParams{
+			UserID:          userID,
+			CursorCreatedAt: page.CursorCreatedAt,
+			CursorID:        page.CursorID,
+			Limit:           page.fetchLimit(),
+		})
+		if err != nil {
+			log.Printf("Error getting timeline: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		chirpPage := newChirpPage(rawChirps, page.Limit)
+		err = hydrateChirps(r, cfg, chirpPage.Chirps)
+		if err != nil {
+			log.Printf("Error loading chirp details: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, chirpPage)
+	})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/thihxm/Chirpy/internal/config"
+	"github.com/thihxm/Chirpy/internal/database"
+	"github.com/thihxm/Chirpy/internal/utils"
+)
+
+const (
+	DEFAULT_TRENDING_WINDOW = 24 * time.Hour
+	MAX_TRENDING_WINDOW     = 7 * 24 * time.Hour
+	DEFAULT_TRENDING_LIMIT  = 10
+	MAX_TRENDING_LIMIT      = 50
+)
+
+type TrendingHashtag struct {
+	Tag  string `json:"tag"`
+	Uses int64  `json:"uses"`
+}
+
+func saveChirpHashtags(r *http.Request, queries *database.Queries, chirp database.Chirp) error {
+	tags := utils.ExtractHashtags(chirp.Body)
+	if len(tags) == 0 {
+		return nil
+	}
+
+	return queries.CreateChirpHashtags(r.Context(), database.CreateChirpHashtagsParams{
+		ChirpID: chirp.ID,
+		Tags:    tags,
+	})
+}
+
+func getHashtagChirpsHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tag := utils.NormalizeHashtag(r.PathValue("tag"))
+		if tag == "" || len(tag) > utils.MaxHashtagLength {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid hashtag")
+			return
+		}
+
+		page, err := parsePageParams(r)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+			return
+		}
+
+		rawChirps, err := cfg.Queries.GetHashtagChirps(r.Context(), database.GetHashtagChirpsParams{
+			Tag:             tag,
+			CursorCreatedAt: page.CursorCreatedAt,
+			CursorID:        page.CursorID,
+			Limit:           page.fetchLimit(),
+		})
+		if err != nil {
+			log.Printf("Error getting hashtag chirps: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		chirpPage := newChirpPage(rawChirps, page.Limit)
+		err = hydrateChirps(r, cfg, chirpPage.Chirps)
+		if err != nil {
+			log.Printf("Error loading chirp details: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, chirpPage)
+	})
+}
+
+func getTrendingHashtagsHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		window := DEFAULT_TRENDING_WINDOW
+		if rawWindow := r.URL.Query().Get("window"); rawWindow != "" {
+			parsedWindow, err := time.ParseDuration(rawWindow)
+			if err != nil || parsedWindow <= 0 || parsedWindow > MAX_TRENDING_WINDOW {
+				utils.RespondWithError(w, http.StatusBadRequest, "Invalid window parameter")
+				return
+			}
+			window = parsedWindow
+		}
+
+		limit := DEFAULT_TRENDING_LIMIT
+		if rawLimit := r.URL.Query().Get("limit"); rawLimit != "" {
+			parsedLimit, err := strconv.Atoi(rawLimit)
+			if err != nil || parsedLimit < 1 {
+				utils.RespondWithError(w, http.StatusBadRequest, "Invalid limit parameter")
+				return
+			}
+			limit = min(parsedLimit, MAX_TRENDING_LIMIT)
+		}
+
+		rows, err := cfg.Queries.GetTrendingHashtags(r.Context(), database.GetTrendingHashtagsParams{
+			Since: time.Now().Add(-window),
+			Limit: int32(limit),
+		})
+		if err != nil {
+			log.Printf("Error getting trending hashtags: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		hashtags := make([]TrendingHashtag, len(rows))
+		for i, row := range rows {
+			hashtags[i] = TrendingHashtag{Tag: row.Tag, Uses: row.Uses}
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, hashtags)
+	})
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"net/http"
@@ -10,51 +11,103 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hashedPassword), nil
+func init() {
+	// Issued-at claims carry microseconds, the precision Postgres keeps, so a
+	// token issued just after a logout can be told apart from one issued just
+	// before it.
+	jwt.TimePrecision = time.Microsecond
 }
 
-func ComparePassword(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+func MakeJWT(userID uuid.UUID, keyring *Keyring, expiresIn time.Duration) (string, error) {
+	return makeToken(userID, keyring, keyring.options.Audience, expiresIn)
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+// MakeChallengeToken issues the token a user trades for a session after
+// passing the second login factor. Its audience keeps it from being accepted
+// as an access token.
+func MakeChallengeToken(userID uuid.UUID, keyring *Keyring, expiresIn time.Duration) (string, error) {
+	return makeToken(userID, keyring, TwoFactorChallengeAudience, expiresIn)
+}
+
+func makeToken(userID uuid.UUID, keyring *Keyring, audience string, expiresIn time.Duration) (string, error) {
 	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
+		Issuer:    TokenIssuer,
+		Audience:  jwt.ClaimStrings{audience},
 		IssuedAt:  jwt.NewNumericDate(time.Now()),
 		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
 		Subject:   userID.String(),
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(tokenSecret))
+	return keyring.sign(claims)
+}
+
+// AccessToken holds the claims the server relies on after a JWT is verified.
+type AccessToken struct {
+	UserID   uuid.UUID
+	IssuedAt time.Time
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
+// IssuedBefore reports whether the token was issued before cutoff, such as
+// the time a user's tokens were invalidated.
+func (t AccessToken) IssuedBefore(cutoff time.Time) bool {
+	return t.IssuedAt.Before(cutoff)
+}
+
+// TokensValidAfter returns the cutoff to store when a user's tokens are
+// invalidated at now. It is rounded up to the next microsecond to cover tokens
+// issued earlier in the same microsecond.
+func TokensValidAfter(now time.Time) time.Time {
+	return now.Truncate(time.Microsecond).Add(time.Microsecond)
+}
+
+func ValidateJWT(tokenString string, keyring *Keyring) (uuid.UUID, error) {
+	accessToken, err := ParseAccessToken(tokenString, keyring)
 	if err != nil {
 		return uuid.Nil, err
 	}
+	return accessToken.UserID, nil
+}
+
+func ParseAccessToken(tokenString string, keyring *Keyring) (AccessToken, error) {
+	return parseToken(tokenString, keyring, keyring.options.Audience)
+}
+
+func ValidateChallengeToken(tokenString string, keyring *Keyring) (uuid.UUID, error) {
+	challenge, err := parseToken(tokenString, keyring, TwoFactorChallengeAudience)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return challenge.UserID, nil
+}
+
+func parseToken(tokenString string, keyring *Keyring, audience string) (AccessToken, error) {
+	token, err := jwt.ParseWithClaims(
+		tokenString,
+		&jwt.RegisteredClaims{},
+		keyring.keyFunc,
+		keyring.parserOptions(audience)...,
+	)
+	if err != nil {
+		return AccessToken{}, err
+	}
 
 	claims, ok := token.Claims.(*jwt.RegisteredClaims)
 	if !ok || !token.Valid {
-		return uuid.Nil, jwt.ErrInvalidKey
+		return AccessToken{}, jwt.ErrInvalidKey
 	}
 
 	userID, err := uuid.Parse(claims.Subject)
 	if err != nil {
-		return uuid.Nil, err
+		return AccessToken{}, err
+	}
+
+	accessToken := AccessToken{UserID: userID}
+	if claims.IssuedAt != nil {
+		accessToken.IssuedAt = claims.IssuedAt.Time
 	}
 
-	return userID, nil
+	return accessToken, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -82,6 +135,13 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(token), nil
 }
 
+// HashRefreshToken returns the digest refresh tokens are stored under, so a
+// database leak doesn't hand out live sessions.
+func HashRefreshToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
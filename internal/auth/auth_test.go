@@ -1,135 +1,411 @@
 package auth
 
 import (
+	"crypto/x509"
+	"errors"
 	"net/http"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-func TestHashPassword(t *testing.T) {
-	t.Run("hashes password", func(t *testing.T) {
-		password := "password"
-		hashedPassword, err := HashPassword(password)
+func TestMakeJWT(t *testing.T) {
+	t.Run("makes JWT", func(t *testing.T) {
+		userID := uuid.New()
+		keyring := newTestKeyring(t, "test-key")
+		expiresIn := 1 * time.Minute
+		token, err := MakeJWT(userID, keyring, expiresIn)
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
 
-		if hashedPassword == password {
-			t.Errorf("expected hashed password, got original password")
+		if token == "" {
+			t.Errorf("expected token, got empty string")
 		}
 	})
 }
 
-func TestComparePassword(t *testing.T) {
-	t.Run("compares password", func(t *testing.T) {
-		password := "password"
-		hashedPassword, err := HashPassword(password)
+func TestValidateJWT(t *testing.T) {
+	t.Run("validates JWT", func(t *testing.T) {
+		userID := uuid.New()
+		keyring := newTestKeyring(t, "test-key")
+		expiresIn := 1 * time.Minute
+		token, err := MakeJWT(userID, keyring, expiresIn)
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
 
-		err = ComparePassword(hashedPassword, password)
+		validUserID, err := ValidateJWT(token, keyring)
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
+
+		if validUserID != userID {
+			t.Errorf("expected: %s, got: %s", userID, validUserID)
+		}
 	})
+}
 
-	t.Run("errors on invalid password", func(t *testing.T) {
-		password := "password"
-		hashedPassword, err := HashPassword(password)
+func TestValidateJWT_ErrorsOnInvalidToken(t *testing.T) {
+	t.Run("errors on invalid token", func(t *testing.T) {
+		token := "invalid"
+		keyring := newTestKeyring(t, "test-key")
+		_, err := ValidateJWT(token, keyring)
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
+
+func TestValidateJWT_ErrorsOnUnknownKey(t *testing.T) {
+	t.Run("errors on token signed by an unknown key", func(t *testing.T) {
+		userID := uuid.New()
+		keyring := newTestKeyring(t, "test-key")
+		expiresIn := 1 * time.Minute
+		token, err := MakeJWT(userID, keyring, expiresIn)
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
 
-		err = ComparePassword(hashedPassword, "invalid-password")
+		_, err = ValidateJWT(token, newTestKeyring(t, "other-key"))
 		if err == nil {
 			t.Errorf("expected error, got nil")
 		}
 	})
 }
 
-func TestMakeJWT(t *testing.T) {
-	t.Run("makes JWT", func(t *testing.T) {
+func TestValidateJWT_ErrorsOnExpiredToken(t *testing.T) {
+	t.Run("errors on token expired beyond the leeway", func(t *testing.T) {
 		userID := uuid.New()
-		tokenSecret := "token-secret"
-		expiresIn := 1 * time.Minute
-		token, err := MakeJWT(userID, tokenSecret, expiresIn)
+		keyring := newTestKeyring(t, "test-key")
+		expiresIn := -(DefaultTokenLeeway + time.Second)
+		token, err := MakeJWT(userID, keyring, expiresIn)
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
 
-		if token == "" {
-			t.Errorf("expected token, got empty string")
+		_, err = ValidateJWT(token, keyring)
+		if !errors.Is(err, jwt.ErrTokenExpired) {
+			t.Errorf("expected: %v, got: %v", jwt.ErrTokenExpired, err)
 		}
 	})
-}
 
-func TestValidateJWT(t *testing.T) {
-	t.Run("validates JWT", func(t *testing.T) {
+	t.Run("accepts token expired within the leeway", func(t *testing.T) {
 		userID := uuid.New()
-		tokenSecret := "token-secret"
-		expiresIn := 1 * time.Minute
-		token, err := MakeJWT(userID, tokenSecret, expiresIn)
+		keyring := newTestKeyring(t, "test-key")
+		token, err := MakeJWT(userID, keyring, -DefaultTokenLeeway/2)
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
 
-		validUserID, err := ValidateJWT(token, tokenSecret)
+		_, err = ValidateJWT(token, keyring)
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
+	})
+}
 
-		if validUserID != userID {
-			t.Errorf("expected: %s, got: %s", userID, validUserID)
+// validClaims returns claims that pass validation, for tests to break one
+// at a time.
+func validClaims(keyring *Keyring) jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Issuer:    TokenIssuer,
+		Audience:  jwt.ClaimStrings{keyring.options.Audience},
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Minute)),
+		Subject:   uuid.New().String(),
+	}
+}
+
+func signTestToken(t *testing.T, keyring *Keyring, claims jwt.RegisteredClaims) string {
+	t.Helper()
+	token, err := keyring.sign(claims)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return token
+}
+
+func TestValidateJWT_ErrorsOnInvalidClaims(t *testing.T) {
+	keyring := newTestKeyring(t, "test-key")
+
+	tests := []struct {
+		name     string
+		claims   func(claims *jwt.RegisteredClaims)
+		expected error
+	}{
+		{
+			name:     "wrong issuer",
+			claims:   func(claims *jwt.RegisteredClaims) { claims.Issuer = "not-chirpy" },
+			expected: jwt.ErrTokenInvalidIssuer,
+		},
+		{
+			name:     "missing issuer",
+			claims:   func(claims *jwt.RegisteredClaims) { claims.Issuer = "" },
+			expected: jwt.ErrTokenRequiredClaimMissing,
+		},
+		{
+			name:     "wrong audience",
+			claims:   func(claims *jwt.RegisteredClaims) { claims.Audience = jwt.ClaimStrings{"other-service"} },
+			expected: jwt.ErrTokenInvalidAudience,
+		},
+		{
+			name:     "missing audience",
+			claims:   func(claims *jwt.RegisteredClaims) { claims.Audience = nil },
+			expected: jwt.ErrTokenRequiredClaimMissing,
+		},
+		{
+			name:     "missing expiration",
+			claims:   func(claims *jwt.RegisteredClaims) { claims.ExpiresAt = nil },
+			expected: jwt.ErrTokenRequiredClaimMissing,
+		},
+		{
+			name: "issued in the future beyond the leeway",
+			claims: func(claims *jwt.RegisteredClaims) {
+				claims.IssuedAt = jwt.NewNumericDate(time.Now().Add(DefaultTokenLeeway + time.Minute))
+			},
+			expected: jwt.ErrTokenUsedBeforeIssued,
+		},
+		{
+			name: "not valid yet beyond the leeway",
+			claims: func(claims *jwt.RegisteredClaims) {
+				claims.NotBefore = jwt.NewNumericDate(time.Now().Add(DefaultTokenLeeway + time.Minute))
+			},
+			expected: jwt.ErrTokenNotValidYet,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := validClaims(keyring)
+			tc.claims(&claims)
+
+			_, err := ValidateJWT(signTestToken(t, keyring, claims), keyring)
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("expected: %v, got: %v", tc.expected, err)
+			}
+		})
+	}
+
+	t.Run("accepts clock skew within the leeway", func(t *testing.T) {
+		claims := validClaims(keyring)
+		claims.IssuedAt = jwt.NewNumericDate(time.Now().Add(DefaultTokenLeeway / 2))
+		claims.NotBefore = jwt.NewNumericDate(time.Now().Add(DefaultTokenLeeway / 2))
+
+		_, err := ValidateJWT(signTestToken(t, keyring, claims), keyring)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
 		}
 	})
 }
 
-func TestValidateJWT_ErrorsOnInvalidToken(t *testing.T) {
-	t.Run("errors on invalid token", func(t *testing.T) {
-		token := "invalid"
-		tokenSecret := "token-secret"
-		_, err := ValidateJWT(token, tokenSecret)
-		if err == nil {
-			t.Errorf("expected error, got nil")
+func TestValidateJWT_ErrorsOnDisallowedAlgorithm(t *testing.T) {
+	t.Run("errors on algorithm that isn't configured", func(t *testing.T) {
+		rsaKey := newTestRSAKey(t, "rsa-key")
+		edKey, err := GenerateSigningKey("ed-key")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		rsaKeyring, err := NewKeyring(rsaKey)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		token, err := MakeJWT(uuid.New(), rsaKeyring, 1*time.Minute)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		keyring, err := NewKeyring(edKey, rsaKey)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		options := DefaultTokenOptions()
+		options.Algorithms = []string{AlgorithmEdDSA}
+		err = keyring.SetTokenOptions(options)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		_, err = ValidateJWT(token, keyring)
+		if !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			t.Errorf("expected: %v, got: %v", jwt.ErrTokenSignatureInvalid, err)
+		}
+	})
+
+	t.Run("errors on unsigned token", func(t *testing.T) {
+		keyring := newTestKeyring(t, "test-key")
+		token := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims(keyring))
+		token.Header["kid"] = "test-key"
+		unsigned, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		_, err = ValidateJWT(unsigned, keyring)
+		if !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			t.Errorf("expected: %v, got: %v", jwt.ErrTokenSignatureInvalid, err)
+		}
+	})
+
+	t.Run("errors on HMAC token keyed with the public key", func(t *testing.T) {
+		key := newTestRSAKey(t, "rsa-key")
+		keyring, err := NewKeyring(key)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		publicKey, err := x509.MarshalPKIXPublicKey(key.publicKey)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims(keyring))
+		token.Header["kid"] = "rsa-key"
+		forged, err := token.SignedString(publicKey)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		_, err = ValidateJWT(forged, keyring)
+		if !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			t.Errorf("expected: %v, got: %v", jwt.ErrTokenSignatureInvalid, err)
+		}
+	})
+
+	t.Run("rejects options that disallow the active key", func(t *testing.T) {
+		keyring := newTestKeyring(t, "test-key")
+		options := DefaultTokenOptions()
+		options.Algorithms = []string{AlgorithmRS256}
+
+		err := keyring.SetTokenOptions(options)
+		if !errors.Is(err, ErrAlgorithmNotAllowed) {
+			t.Errorf("expected: %v, got: %v", ErrAlgorithmNotAllowed, err)
 		}
 	})
 }
 
-func TestValidateJWT_ErrorsOnInvalidTokenSecret(t *testing.T) {
-	t.Run("errors on invalid token secret", func(t *testing.T) {
+func TestParseAccessToken(t *testing.T) {
+	t.Run("returns the issued-at time", func(t *testing.T) {
 		userID := uuid.New()
-		tokenSecret := "token-secret"
-		expiresIn := 1 * time.Minute
-		token, err := MakeJWT(userID, tokenSecret, expiresIn)
+		keyring := newTestKeyring(t, "test-key")
+		before := time.Now().Truncate(time.Second)
+		token, err := MakeJWT(userID, keyring, 1*time.Minute)
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
 
-		_, err = ValidateJWT(token, "invalid-token-secret")
-		if err == nil {
-			t.Errorf("expected error, got nil")
+		accessToken, err := ParseAccessToken(token, keyring)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if accessToken.UserID != userID {
+			t.Errorf("expected: %v, got: %v", userID, accessToken.UserID)
+		}
+
+		if accessToken.IssuedAt.Before(before) || accessToken.IssuedAt.After(time.Now()) {
+			t.Errorf("unexpected issued-at time: %v", accessToken.IssuedAt)
 		}
 	})
 }
 
-func TestValidateJWT_ErrorsOnExpiredToken(t *testing.T) {
-	t.Run("errors on expired token", func(t *testing.T) {
-		userID := uuid.New()
-		tokenSecret := "token-secret"
-		expiresIn := 20 * time.Millisecond
-		token, err := MakeJWT(userID, tokenSecret, expiresIn)
+func TestTokensValidAfter(t *testing.T) {
+	t.Run("rejects a token issued before the logout", func(t *testing.T) {
+		keyring := newTestKeyring(t, "test-key")
+		token, err := MakeJWT(uuid.New(), keyring, 1*time.Minute)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		accessToken, err := ParseAccessToken(token, keyring)
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
 
-		time.Sleep(50 * time.Millisecond)
+		cutoff := TokensValidAfter(time.Now())
+		if !accessToken.IssuedBefore(cutoff) {
+			t.Errorf("expected token issued at %v to be rejected by cutoff %v", accessToken.IssuedAt, cutoff)
+		}
+	})
 
-		_, err = ValidateJWT(token, tokenSecret)
-		if err == nil {
-			t.Errorf("expected error, got nil")
+	t.Run("accepts a token issued in the same second after the logout", func(t *testing.T) {
+		// Stay clear of a second boundary so both fall in the same second.
+		if time.Now().Nanosecond() > 900_000_000 {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		keyring := newTestKeyring(t, "test-key")
+		logoutAt := time.Now()
+		cutoff := TokensValidAfter(logoutAt)
+		time.Sleep(time.Millisecond)
+
+		token, err := MakeJWT(uuid.New(), keyring, 1*time.Minute)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		accessToken, err := ParseAccessToken(token, keyring)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if accessToken.IssuedAt.Unix() != logoutAt.Unix() {
+			t.Fatalf("expected token issued in the logout second, got: %v", accessToken.IssuedAt)
+		}
+		if accessToken.IssuedBefore(cutoff) {
+			t.Errorf("expected token issued at %v to be accepted by cutoff %v", accessToken.IssuedAt, cutoff)
+		}
+	})
+
+	logoutAt := time.Date(2024, 3, 1, 12, 0, 0, 250_000_400, time.UTC)
+
+	var tests = []struct {
+		name     string
+		issuedAt time.Time
+		expected bool
+	}{
+		{"issued earlier", logoutAt.Add(-time.Hour), true},
+		{"issued earlier in the logout second", logoutAt.Add(-200 * time.Millisecond), true},
+		{"issued in the logout microsecond", logoutAt.Truncate(time.Microsecond), true},
+		{"issued in the next microsecond", logoutAt.Truncate(time.Microsecond).Add(time.Microsecond), false},
+		{"issued later in the logout second", logoutAt.Add(500 * time.Millisecond), false},
+		{"issued later", logoutAt.Add(time.Hour), false},
+		{"issued in another time zone", logoutAt.Add(-time.Millisecond).In(time.FixedZone("BRT", -3*60*60)), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rejected := AccessToken{IssuedAt: tt.issuedAt}.IssuedBefore(TokensValidAfter(logoutAt))
+			if rejected != tt.expected {
+				t.Errorf("expected rejected: %v, got: %v", tt.expected, rejected)
+			}
+		})
+	}
+}
+
+func TestHashRefreshToken(t *testing.T) {
+	t.Run("hashes refresh token", func(t *testing.T) {
+		token, err := MakeRefreshToken()
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		hashedToken := HashRefreshToken(token)
+		if hashedToken == token {
+			t.Errorf("expected hashed token, got original token")
+		}
+
+		if HashRefreshToken(token) != hashedToken {
+			t.Errorf("expected the same digest for the same token")
+		}
+	})
+
+	t.Run("matches the digest used by the migration", func(t *testing.T) {
+		expected := "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+		if hashedToken := HashRefreshToken("foo"); hashedToken != expected {
+			t.Errorf("expected: %s, got: %s", expected, hashedToken)
 		}
 	})
 }
@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmRS256 = "RS256"
+)
+
+const (
+	TokenIssuer          = "chirpy"
+	DefaultTokenAudience = "chirpy"
+	DefaultTokenLeeway   = 30 * time.Second
+
+	TwoFactorChallengeAudience = "chirpy-2fa-challenge"
+)
+
+var (
+	ErrUnknownKeyID        = errors.New("unknown key ID")
+	ErrAlgorithmNotAllowed = errors.New("signing algorithm not allowed")
+	ErrUnsupportedKey      = errors.New("unsupported key type")
+	ErrSigningKeyNotActive = errors.New("active key has no private key")
+)
+
+// SigningKey is a key used to sign or verify access tokens. Retired keys
+// only need their public half, since they no longer sign anything.
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	privateKey crypto.Signer
+	publicKey  crypto.PublicKey
+}
+
+func (k SigningKey) method() jwt.SigningMethod {
+	if k.Algorithm == AlgorithmEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+func newSigningKey(kid string, key any) (SigningKey, error) {
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		return SigningKey{ID: kid, Algorithm: AlgorithmEdDSA, privateKey: key, publicKey: key.Public()}, nil
+	case ed25519.PublicKey:
+		return SigningKey{ID: kid, Algorithm: AlgorithmEdDSA, publicKey: key}, nil
+	case *rsa.PrivateKey:
+		return SigningKey{ID: kid, Algorithm: AlgorithmRS256, privateKey: key, publicKey: &key.PublicKey}, nil
+	case *rsa.PublicKey:
+		return SigningKey{ID: kid, Algorithm: AlgorithmRS256, publicKey: key}, nil
+	}
+	return SigningKey{}, ErrUnsupportedKey
+}
+
+// ParseSigningKey reads a PEM encoded Ed25519 or RSA key. PKCS#8 private
+// keys and PKIX public keys are accepted.
+func ParseSigningKey(kid string, pemBytes []byte) (SigningKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return SigningKey{}, fmt.Errorf("key %s: no PEM data found", kid)
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return SigningKey{}, fmt.Errorf("key %s: unexpected PEM block %q", kid, block.Type)
+	}
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("key %s: %w", kid, err)
+	}
+
+	return newSigningKey(kid, key)
+}
+
+// GenerateSigningKey creates a fresh Ed25519 key.
+func GenerateSigningKey(kid string) (SigningKey, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	return newSigningKey(kid, privateKey)
+}
+
+// TokenOptions control which claims access tokens are issued with and what
+// validation requires of them.
+type TokenOptions struct {
+	Audience string
+	// Algorithms lists the signing algorithms accepted on incoming tokens.
+	Algorithms []string
+	// Leeway is the clock skew tolerated on the exp, nbf and iat claims.
+	Leeway time.Duration
+}
+
+func DefaultTokenOptions() TokenOptions {
+	return TokenOptions{
+		Audience:   DefaultTokenAudience,
+		Algorithms: []string{AlgorithmEdDSA, AlgorithmRS256},
+		Leeway:     DefaultTokenLeeway,
+	}
+}
+
+// Keyring signs tokens with its active key and verifies tokens signed by any
+// key it holds, so retired keys keep working until their tokens expire.
+type Keyring struct {
+	active  SigningKey
+	keys    map[string]SigningKey
+	options TokenOptions
+}
+
+func NewKeyring(active SigningKey, retired ...SigningKey) (*Keyring, error) {
+	if active.privateKey == nil {
+		return nil, ErrSigningKeyNotActive
+	}
+
+	keys := map[string]SigningKey{active.ID: active}
+	for _, key := range retired {
+		if _, ok := keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key ID %s", key.ID)
+		}
+		keys[key.ID] = key
+	}
+
+	return &Keyring{active: active, keys: keys, options: DefaultTokenOptions()}, nil
+}
+
+// SetTokenOptions replaces the keyring's token options. The active key's
+// algorithm has to be allowed, otherwise its own tokens would be rejected.
+func (k *Keyring) SetTokenOptions(options TokenOptions) error {
+	if options.Audience == "" {
+		return errors.New("token audience is required")
+	}
+	if options.Audience == TwoFactorChallengeAudience {
+		return errors.New("token audience is reserved for 2FA challenges")
+	}
+	if options.Leeway < 0 {
+		return errors.New("token leeway can't be negative")
+	}
+	for _, algorithm := range options.Algorithms {
+		if algorithm != AlgorithmEdDSA && algorithm != AlgorithmRS256 {
+			return fmt.Errorf("%w: %s", ErrAlgorithmNotAllowed, algorithm)
+		}
+	}
+	if !slices.Contains(options.Algorithms, k.active.Algorithm) {
+		return fmt.Errorf("%w: active key uses %s", ErrAlgorithmNotAllowed, k.active.Algorithm)
+	}
+
+	k.options = options
+	return nil
+}
+
+func (k *Keyring) parserOptions(audience string) []jwt.ParserOption {
+	return []jwt.ParserOption{
+		jwt.WithValidMethods(k.options.Algorithms),
+		jwt.WithIssuer(TokenIssuer),
+		jwt.WithAudience(audience),
+		jwt.WithLeeway(k.options.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+}
+
+func (k *Keyring) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.active.method(), claims)
+	token.Header["kid"] = k.active.ID
+	return token.SignedString(k.active.privateKey)
+}
+
+// keyFunc picks the verification key from the token's kid header and makes
+// sure the token was signed with the algorithm that key belongs to.
+func (k *Keyring) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+	if token.Method.Alg() != key.Algorithm || !slices.Contains(k.options.Algorithms, key.Algorithm) {
+		return nil, ErrAlgorithmNotAllowed
+	}
+	return key.publicKey, nil
+}
+
+// JWK is the public half of a signing key as described in RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns every public key in the keyring, active key first.
+func (k *Keyring) JWKS() JWKSet {
+	retired := make([]string, 0, len(k.keys))
+	for kid := range k.keys {
+		if kid != k.active.ID {
+			retired = append(retired, kid)
+		}
+	}
+	sort.Strings(retired)
+
+	set := JWKSet{Keys: []JWK{publicJWK(k.active)}}
+	for _, kid := range retired {
+		set.Keys = append(set.Keys, publicJWK(k.keys[kid]))
+	}
+	return set
+}
+
+func publicJWK(key SigningKey) JWK {
+	jwk := JWK{KeyID: key.ID, Algorithm: key.Algorithm, Use: "sig"}
+	switch publicKey := key.publicKey.(type) {
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	}
+	return jwk
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newTestKeyring(t *testing.T, kid string) *Keyring {
+	t.Helper()
+	key, err := GenerateSigningKey(kid)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keyring, err := NewKeyring(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return keyring
+}
+
+func newTestRSAKey(t *testing.T, kid string) SigningKey {
+	t.Helper()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	key, err := ParseSigningKey(kid, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return key
+}
+
+func TestKeyring_RS256(t *testing.T) {
+	t.Run("signs and validates with an RSA key", func(t *testing.T) {
+		key := newTestRSAKey(t, "rsa-key")
+		if key.Algorithm != AlgorithmRS256 {
+			t.Errorf("expected: %s, got: %s", AlgorithmRS256, key.Algorithm)
+		}
+
+		keyring, err := NewKeyring(key)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		userID := uuid.New()
+		token, err := MakeJWT(userID, keyring, 1*time.Minute)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		validUserID, err := ValidateJWT(token, keyring)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if validUserID != userID {
+			t.Errorf("expected: %s, got: %s", userID, validUserID)
+		}
+	})
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	t.Run("accepts tokens signed by a retired key", func(t *testing.T) {
+		oldKey, err := GenerateSigningKey("old-key")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		oldKeyring, err := NewKeyring(oldKey)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		userID := uuid.New()
+		token, err := MakeJWT(userID, oldKeyring, 1*time.Minute)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		newKeyring, err := NewKeyring(newTestRSAKey(t, "new-key"), oldKey)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		validUserID, err := ValidateJWT(token, newKeyring)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if validUserID != userID {
+			t.Errorf("expected: %s, got: %s", userID, validUserID)
+		}
+	})
+
+	t.Run("errors when the key ID is reused with another key", func(t *testing.T) {
+		token, err := MakeJWT(uuid.New(), newTestKeyring(t, "test-key"), 1*time.Minute)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		_, err = ValidateJWT(token, newTestKeyring(t, "test-key"))
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+
+	t.Run("errors when the active key has no private key", func(t *testing.T) {
+		key := newTestRSAKey(t, "rsa-key")
+		der, err := x509.MarshalPKIXPublicKey(key.publicKey)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		publicKey, err := ParseSigningKey("rsa-key", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		_, err = NewKeyring(publicKey)
+		if err != ErrSigningKeyNotActive {
+			t.Errorf("expected: %v, got: %v", ErrSigningKeyNotActive, err)
+		}
+	})
+}
+
+func TestKeyring_ErrorsOnAlgorithmMismatch(t *testing.T) {
+	t.Run("errors when the token algorithm doesn't match its key", func(t *testing.T) {
+		keyring := newTestKeyring(t, "test-key")
+
+		claims := jwt.RegisteredClaims{
+			Subject:   uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Minute)),
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test-key"
+		signed, err := token.SignedString(newTestRSAKey(t, "test-key").privateKey)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		_, err = ValidateJWT(signed, keyring)
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
+
+func TestKeyring_JWKS(t *testing.T) {
+	t.Run("lists the active key first", func(t *testing.T) {
+		retired, err := GenerateSigningKey("retired-key")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		keyring, err := NewKeyring(newTestRSAKey(t, "active-key"), retired)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		jwks := keyring.JWKS()
+		if len(jwks.Keys) != 2 {
+			t.Fatalf("expected 2 keys, got %d", len(jwks.Keys))
+		}
+
+		active := jwks.Keys[0]
+		if active.KeyID != "active-key" || active.KeyType != "RSA" || active.N == "" || active.E != "AQAB" {
+			t.Errorf("unexpected active key: %+v", active)
+		}
+
+		if jwks.Keys[1].KeyID != "retired-key" || jwks.Keys[1].KeyType != "OKP" || jwks.Keys[1].X == "" {
+			t.Errorf("unexpected retired key: %+v", jwks.Keys[1])
+		}
+	})
+}
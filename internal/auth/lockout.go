@@ -0,0 +1,35 @@
+package auth
+
+import "time"
+
+// LockoutPolicy turns a count of recent failed logins into how long the next
+// attempt has to wait. The delay doubles with every failure past the free
+// ones, and reaching the threshold locks logins out for LockoutDuration.
+type LockoutPolicy struct {
+	FreeAttempts     int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// Window is how long failures are remembered. A failure after a quiet
+	// period this long starts counting from one again.
+	Window time.Duration
+}
+
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if failures >= p.LockoutThreshold {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for range failures - p.FreeAttempts - 1 {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return min(delay, p.MaxDelay)
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicy_Delay(t *testing.T) {
+	policy := LockoutPolicy{
+		FreeAttempts:     3,
+		BaseDelay:        1 * time.Second,
+		MaxDelay:         1 * time.Minute,
+		LockoutThreshold: 20,
+		LockoutDuration:  15 * time.Minute,
+	}
+
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{failures: 0, expected: 0},
+		{failures: 3, expected: 0},
+		{failures: 4, expected: 1 * time.Second},
+		{failures: 5, expected: 2 * time.Second},
+		{failures: 6, expected: 4 * time.Second},
+		{failures: 9, expected: 32 * time.Second},
+		{failures: 10, expected: 1 * time.Minute},
+		{failures: 19, expected: 1 * time.Minute},
+		{failures: 20, expected: 15 * time.Minute},
+		{failures: 1000, expected: 15 * time.Minute},
+	}
+
+	for _, tc := range tests {
+		if delay := policy.Delay(tc.failures); delay != tc.expected {
+			t.Errorf("failures: %d, expected: %v, got: %v", tc.failures, tc.expected, delay)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasswordMismatch = errors.New("password doesn't match")
+	ErrUnsupportedHash  = errors.New("unsupported password hash format")
+)
+
+// PasswordHasher hashes passwords into self-describing strings, so the
+// algorithm and its parameters can change without breaking stored hashes.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify returns ErrPasswordMismatch for a wrong password and
+	// ErrUnsupportedHash for hashes made by another algorithm. needsRehash
+	// reports that the hash should be replaced with a fresh one.
+	Verify(hash, password string) (needsRehash bool, err error)
+}
+
+// Argon2idParams are the cost settings for argon2id. Memory is in KiB.
+type Argon2idParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follow the second recommended option of RFC 9106.
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Stored hashes with parameters outside these bounds are rejected instead of
+// verified, so a bad row can't make a login allocate gigabytes, spin for
+// minutes or compare against an empty key.
+const (
+	maxArgon2idMemory      = 256 * 1024
+	maxArgon2idIterations  = 10
+	maxArgon2idParallelism = 16
+	minArgon2idSaltLength  = 8
+	maxArgon2idSaltLength  = 64
+	minArgon2idKeyLength   = 16
+	maxArgon2idKeyLength   = 64
+)
+
+// bcryptMemory is roughly what a bcrypt hash needs, in KiB.
+const bcryptMemory = 4
+
+// Argon2idHasher stores hashes in the PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+type Argon2idHasher struct {
+	Params Argon2idParams
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.Params.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Params.Iterations, h.Params.Memory, h.Params.Parallelism, h.Params.KeyLength)
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.Params.Memory,
+		h.Params.Iterations,
+		h.Params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h Argon2idHasher) Verify(hash, password string) (bool, error) {
+	params, salt, key, err := parseArgon2idHash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(candidate, key) != 1 {
+		return false, ErrPasswordMismatch
+	}
+
+	needsRehash := params.Memory != h.Params.Memory ||
+		params.Iterations != h.Params.Iterations ||
+		params.Parallelism != h.Params.Parallelism ||
+		params.SaltLength != h.Params.SaltLength ||
+		params.KeyLength != h.Params.KeyLength
+	return needsRehash, nil
+}
+
+func parseArgon2idHash(hash string) (Argon2idParams, []byte, []byte, error) {
+	// "$argon2id$v=19$m=...,t=...,p=...$salt$hash" splits into six parts,
+	// the first one empty.
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2idParams{}, nil, nil, ErrUnsupportedHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return Argon2idParams{}, nil, nil, ErrUnsupportedHash
+	}
+
+	params := Argon2idParams{}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil ||
+		params.Memory > maxArgon2idMemory ||
+		params.Iterations < 1 || params.Iterations > maxArgon2idIterations ||
+		params.Parallelism < 1 || params.Parallelism > maxArgon2idParallelism {
+		return Argon2idParams{}, nil, nil, ErrUnsupportedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, ErrUnsupportedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, ErrUnsupportedHash
+	}
+	if len(salt) < minArgon2idSaltLength || len(salt) > maxArgon2idSaltLength ||
+		len(key) < minArgon2idKeyLength || len(key) > maxArgon2idKeyLength {
+		return Argon2idParams{}, nil, nil, ErrUnsupportedHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// BcryptHasher handles the $2a$/$2b$/$2y$ hashes bcrypt has always produced.
+// bcrypt rejects passwords longer than 72 bytes, so it is kept for existing
+// hashes rather than new ones.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
+func (h BcryptHasher) Verify(hash, password string) (bool, error) {
+	if !strings.HasPrefix(hash, "$2a$") && !strings.HasPrefix(hash, "$2b$") && !strings.HasPrefix(hash, "$2y$") {
+		return false, ErrUnsupportedHash
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, ErrPasswordMismatch
+	}
+	if err != nil {
+		return false, err
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false, err
+	}
+	return cost != h.Cost, nil
+}
+
+// MigratingHasher hashes with Current and still verifies hashes made by the
+// Legacy hashers, flagging those for a rehash.
+type MigratingHasher struct {
+	Current PasswordHasher
+	Legacy  []PasswordHasher
+}
+
+func (h MigratingHasher) Hash(password string) (string, error) {
+	return h.Current.Hash(password)
+}
+
+func (h MigratingHasher) Verify(hash, password string) (bool, error) {
+	needsRehash, err := h.Current.Verify(hash, password)
+	if !errors.Is(err, ErrUnsupportedHash) {
+		return needsRehash, err
+	}
+
+	for _, legacy := range h.Legacy {
+		_, err := legacy.Verify(hash, password)
+		if errors.Is(err, ErrUnsupportedHash) {
+			continue
+		}
+		return err == nil, err
+	}
+	return false, ErrUnsupportedHash
+}
+
+// DefaultPasswordHasher hashes new passwords with argon2id and accepts the
+// bcrypt hashes stored before it existed.
+func DefaultPasswordHasher() PasswordHasher {
+	return MigratingHasher{
+		Current: Argon2idHasher{Params: DefaultArgon2idParams},
+		Legacy:  []PasswordHasher{BcryptHasher{Cost: bcrypt.DefaultCost}},
+	}
+}
+
+// LimitedHasher keeps the memory used by concurrent hashes within a budget.
+// Every argon2id hash allocates its whole memory cost, so without a limit a
+// burst of logins could exhaust memory. Calls that don't fit wait until
+// enough memory is released. A single hash larger than the budget waits until
+// it can run alone.
+type LimitedHasher struct {
+	hasher     PasswordHasher
+	budget     uint64
+	hashMemory uint64
+
+	mu        sync.Mutex
+	released  *sync.Cond
+	available uint64
+}
+
+// NewLimitedHasher wraps hasher with a memory budget. hashMemory is what a
+// call to Hash allocates. Both are in KiB, like Argon2idParams.Memory.
+func NewLimitedHasher(hasher PasswordHasher, memoryBudget, hashMemory uint32) *LimitedHasher {
+	h := &LimitedHasher{
+		hasher:     hasher,
+		budget:     uint64(memoryBudget),
+		hashMemory: uint64(hashMemory),
+		available:  uint64(memoryBudget),
+	}
+	h.released = sync.NewCond(&h.mu)
+	return h
+}
+
+func (h *LimitedHasher) Hash(password string) (string, error) {
+	release := h.acquire(h.hashMemory)
+	defer release()
+	return h.hasher.Hash(password)
+}
+
+func (h *LimitedHasher) Verify(hash, password string) (bool, error) {
+	// Verifying costs whatever the stored hash asks for. Other formats, such
+	// as bcrypt, only need a few KiB.
+	memory := uint64(bcryptMemory)
+	if params, _, _, err := parseArgon2idHash(hash); err == nil {
+		memory = uint64(params.Memory)
+	}
+
+	release := h.acquire(memory)
+	defer release()
+	return h.hasher.Verify(hash, password)
+}
+
+func (h *LimitedHasher) acquire(memory uint64) (release func()) {
+	memory = min(max(memory, 1), h.budget)
+
+	h.mu.Lock()
+	for h.available < memory {
+		h.released.Wait()
+	}
+	h.available -= memory
+	h.mu.Unlock()
+
+	return func() {
+		h.mu.Lock()
+		h.available += memory
+		h.mu.Unlock()
+		h.released.Broadcast()
+	}
+}
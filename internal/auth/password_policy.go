@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	PasswordTooShort = "too_short"
+	PasswordTooLong  = "too_long"
+	PasswordTooWeak  = "too_weak"
+	PasswordBreached = "breached"
+)
+
+// PasswordViolation is one reason a password was rejected. Code is stable
+// for clients to switch on, Message is meant for people.
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicy decides whether a new password is acceptable. Breached is
+// optional; without it passwords aren't checked against known breaches.
+type PasswordPolicy struct {
+	MinLength      int
+	MaxLength      int
+	MinEntropyBits float64
+	Breached       *BreachedPasswordList
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:      8,
+	MaxLength:      256,
+	MinEntropyBits: 40,
+}
+
+// Validate returns every rule the password breaks. An error means the
+// breached list couldn't be read; the violations found so far are still
+// returned.
+func (p PasswordPolicy) Validate(password string) ([]PasswordViolation, error) {
+	violations := []PasswordViolation{}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooShort,
+			Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooLong,
+			Message: fmt.Sprintf("Password must be at most %d characters long", p.MaxLength),
+		})
+	}
+	if length >= p.MinLength && EstimatePasswordEntropy(password) < p.MinEntropyBits {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooWeak,
+			Message: "Password is too easy to guess, use a longer or more varied one",
+		})
+	}
+
+	if p.Breached == nil || password == "" {
+		return violations, nil
+	}
+
+	breached, err := p.Breached.Contains(password)
+	if err != nil {
+		return violations, err
+	}
+	if breached {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordBreached,
+			Message: "Password has appeared in a data breach, choose a different one",
+		})
+	}
+	return violations, nil
+}
+
+// EstimatePasswordEntropy gives a rough upper bound of a password's entropy
+// in bits, from the character classes it uses and its length. Repeated
+// characters and runs such as "abc" or "321" don't add to the length.
+func EstimatePasswordEntropy(password string) float64 {
+	var hasLower, hasUpper, hasDigit, hasSymbol, hasOther bool
+	effectiveLength := 0
+	var previous, step rune
+
+	for i, c := range []rune(password) {
+		switch {
+		case c < unicode.MaxASCII && unicode.IsLower(c):
+			hasLower = true
+		case c < unicode.MaxASCII && unicode.IsUpper(c):
+			hasUpper = true
+		case c < unicode.MaxASCII && unicode.IsDigit(c):
+			hasDigit = true
+		case c < unicode.MaxASCII && unicode.IsPrint(c):
+			hasSymbol = true
+		default:
+			hasOther = true
+		}
+
+		// A character that repeats the previous one or continues a run of
+		// consecutive characters is easy to predict.
+		delta := c - previous
+		predictable := i > 0 && (delta == 0 || (i > 1 && delta == step && (delta == 1 || delta == -1)))
+		if !predictable {
+			effectiveLength++
+		}
+		step = delta
+		previous = c
+	}
+
+	pool := 0
+	if hasLower {
+		pool += 26
+	}
+	if hasUpper {
+		pool += 26
+	}
+	if hasDigit {
+		pool += 10
+	}
+	if hasSymbol {
+		pool += 33
+	}
+	if hasOther {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	return float64(effectiveLength) * math.Log2(float64(pool))
+}
+
+// BreachedPasswordList looks passwords up in a local copy of a breached
+// password corpus laid out like the Pwned Passwords range API: Dir holds one
+// file per 5 character SHA-1 prefix, named after the uppercase prefix with an
+// optional .txt extension, listing the remaining 35 characters of each hash as
+// SUFFIX or SUFFIX:COUNT lines. Only the file for the password's prefix is
+// read, so the full corpus never has to fit in memory.
+type BreachedPasswordList struct {
+	Dir string
+}
+
+func (l *BreachedPasswordList) Contains(password string) (bool, error) {
+	digest := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(digest[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := l.openRange(prefix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		// Padding entries in range files have a count of zero.
+		if count == "0" {
+			continue
+		}
+		if strings.EqualFold(entry, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func (l *BreachedPasswordList) openRange(prefix string) (*os.File, error) {
+	file, err := os.Open(filepath.Join(l.Dir, prefix))
+	if errors.Is(err, fs.ErrNotExist) {
+		file, err = os.Open(filepath.Join(l.Dir, prefix+".txt"))
+	}
+	return file, err
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// "password" hashes to 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8.
+func newTestBreachedList(t *testing.T) *BreachedPasswordList {
+	t.Helper()
+	dir := t.TempDir()
+
+	rangeFile := strings.Join([]string{
+		"003D68EB55068C33ACE09247EE4C639306B:3",
+		"1E4C9B93F3F0682250B6CF8331B7EE68FD8:9659365",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:0",
+	}, "\r\n")
+	err := os.WriteFile(filepath.Join(dir, "5BAA6.txt"), []byte(rangeFile), 0o644)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return &BreachedPasswordList{Dir: dir}
+}
+
+func violationCodes(violations []PasswordViolation) []string {
+	codes := []string{}
+	for _, violation := range violations {
+		codes = append(codes, violation.Code)
+	}
+	return codes
+}
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	policy := PasswordPolicy{
+		MinLength:      8,
+		MaxLength:      64,
+		MinEntropyBits: 40,
+		Breached:       newTestBreachedList(t),
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		expected []string
+	}{
+		{name: "empty", password: "", expected: []string{PasswordTooShort}},
+		{name: "short", password: "x7#Lq", expected: []string{PasswordTooShort}},
+		{name: "long", password: strings.Repeat("x7#Lq", 20), expected: []string{PasswordTooLong}},
+		{name: "repeated characters", password: "aaaaaaaaaaaa", expected: []string{PasswordTooWeak}},
+		{name: "sequence", password: "abcdefghijkl", expected: []string{PasswordTooWeak}},
+		{name: "breached", password: "password", expected: []string{PasswordTooWeak, PasswordBreached}},
+		{name: "strong", password: "correct horse battery staple", expected: []string{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			violations, err := policy.Validate(tc.password)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			codes := violationCodes(violations)
+			if strings.Join(codes, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("expected: %v, got: %v", tc.expected, codes)
+			}
+		})
+	}
+}
+
+func TestEstimatePasswordEntropy(t *testing.T) {
+	t.Run("rewards length and variety", func(t *testing.T) {
+		weak := EstimatePasswordEntropy("abcabcab")
+		strong := EstimatePasswordEntropy("T7#kq!Vz9@pW")
+		if weak >= strong {
+			t.Errorf("expected %v to be lower than %v", weak, strong)
+		}
+	})
+
+	t.Run("ignores repeats and runs", func(t *testing.T) {
+		if EstimatePasswordEntropy("aaaaaaaa") != EstimatePasswordEntropy("a") {
+			t.Errorf("expected repeated characters not to add entropy")
+		}
+
+		if EstimatePasswordEntropy("123456789") != EstimatePasswordEntropy("12") {
+			t.Errorf("expected a run not to add entropy")
+		}
+	})
+}
+
+func TestBreachedPasswordList_Contains(t *testing.T) {
+	list := newTestBreachedList(t)
+
+	t.Run("finds breached password", func(t *testing.T) {
+		breached, err := list.Contains("password")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if !breached {
+			t.Errorf("expected password to be breached")
+		}
+	})
+
+	t.Run("ignores passwords missing from the range", func(t *testing.T) {
+		breached, err := list.Contains("correct horse battery staple")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if breached {
+			t.Errorf("expected password not to be breached")
+		}
+	})
+
+	t.Run("errors when the range can't be read", func(t *testing.T) {
+		dir := t.TempDir()
+		err := os.Mkdir(filepath.Join(dir, "5BAA6"), 0o755)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, err = (&BreachedPasswordList{Dir: dir}).Contains("password")
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
@@ -0,0 +1,309 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2idParams keep the tests fast. They are far too weak for real use.
+var testArgon2idParams = Argon2idParams{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestDefaultPasswordHasher(t *testing.T) {
+	hasher := DefaultPasswordHasher()
+
+	t.Run("hashes password", func(t *testing.T) {
+		password := "password"
+		hashedPassword, err := hasher.Hash(password)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if hashedPassword == password {
+			t.Errorf("expected hashed password, got original password")
+		}
+	})
+
+	t.Run("compares password", func(t *testing.T) {
+		password := "password"
+		hashedPassword, err := hasher.Hash(password)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		_, err = hasher.Verify(hashedPassword, password)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("errors on invalid password", func(t *testing.T) {
+		password := "password"
+		hashedPassword, err := hasher.Hash(password)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		_, err = hasher.Verify(hashedPassword, "invalid-password")
+		if !errors.Is(err, ErrPasswordMismatch) {
+			t.Errorf("expected: %v, got: %v", ErrPasswordMismatch, err)
+		}
+	})
+}
+
+func TestArgon2idHasher(t *testing.T) {
+	hasher := Argon2idHasher{Params: testArgon2idParams}
+
+	t.Run("produces a PHC string", func(t *testing.T) {
+		hash, err := hasher.Hash("password")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+			t.Errorf("unexpected hash format: %s", hash)
+		}
+	})
+
+	t.Run("verifies passwords longer than 72 bytes", func(t *testing.T) {
+		password := strings.Repeat("a", 100)
+		hash, err := hasher.Hash(password)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		needsRehash, err := hasher.Verify(hash, password)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if needsRehash {
+			t.Errorf("expected no rehash")
+		}
+
+		_, err = hasher.Verify(hash, strings.Repeat("a", 99)+"b")
+		if !errors.Is(err, ErrPasswordMismatch) {
+			t.Errorf("expected: %v, got: %v", ErrPasswordMismatch, err)
+		}
+	})
+
+	t.Run("asks for a rehash when the parameters changed", func(t *testing.T) {
+		hash, err := hasher.Hash("password")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		stronger := testArgon2idParams
+		stronger.Iterations = 2
+		needsRehash, err := Argon2idHasher{Params: stronger}.Verify(hash, "password")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if !needsRehash {
+			t.Errorf("expected a rehash")
+		}
+	})
+
+	t.Run("rejects parameters outside the bounds", func(t *testing.T) {
+		salt := "c2FsdHNhbHRzYWx0c2FsdA"
+		key := "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+		var tests = []struct {
+			name string
+			hash string
+		}{
+			{"too much memory", "$argon2id$v=19$m=4194304,t=1,p=1$" + salt + "$" + key},
+			{"too many iterations", "$argon2id$v=19$m=1024,t=1000,p=1$" + salt + "$" + key},
+			{"zero iterations", "$argon2id$v=19$m=1024,t=0,p=1$" + salt + "$" + key},
+			{"too much parallelism", "$argon2id$v=19$m=1024,t=1,p=255$" + salt + "$" + key},
+			{"zero parallelism", "$argon2id$v=19$m=1024,t=1,p=0$" + salt + "$" + key},
+			{"short salt", "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$" + key},
+			{"empty key", "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$"},
+			{"long key", "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$" + strings.Repeat("a", 100)},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := hasher.Verify(tt.hash, "password")
+				if !errors.Is(err, ErrUnsupportedHash) {
+					t.Errorf("expected: %v, got: %v", ErrUnsupportedHash, err)
+				}
+			})
+		}
+	})
+
+	t.Run("errors on other hash formats", func(t *testing.T) {
+		for _, hash := range []string{"", "$2a$10$abc", "$argon2i$v=19$m=1024,t=1,p=1$c2FsdA$aGFzaA", "$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$aGFzaA"} {
+			_, err := hasher.Verify(hash, "password")
+			if !errors.Is(err, ErrUnsupportedHash) {
+				t.Errorf("hash: %q, expected: %v, got: %v", hash, ErrUnsupportedHash, err)
+			}
+		}
+	})
+}
+
+func TestBcryptHasher(t *testing.T) {
+	hasher := BcryptHasher{Cost: bcrypt.MinCost}
+
+	t.Run("verifies bcrypt hashes", func(t *testing.T) {
+		hash, err := hasher.Hash("password")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		_, err = hasher.Verify(hash, "password")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		_, err = hasher.Verify(hash, "invalid-password")
+		if !errors.Is(err, ErrPasswordMismatch) {
+			t.Errorf("expected: %v, got: %v", ErrPasswordMismatch, err)
+		}
+	})
+
+	t.Run("rejects passwords longer than 72 bytes", func(t *testing.T) {
+		_, err := hasher.Hash(strings.Repeat("a", 73))
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
+
+func TestMigratingHasher(t *testing.T) {
+	legacy := BcryptHasher{Cost: bcrypt.MinCost}
+	hasher := MigratingHasher{
+		Current: Argon2idHasher{Params: testArgon2idParams},
+		Legacy:  []PasswordHasher{legacy},
+	}
+
+	t.Run("hashes with the current hasher", func(t *testing.T) {
+		hash, err := hasher.Hash("password")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if !strings.HasPrefix(hash, "$argon2id$") {
+			t.Errorf("unexpected hash format: %s", hash)
+		}
+
+		needsRehash, err := hasher.Verify(hash, "password")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if needsRehash {
+			t.Errorf("expected no rehash")
+		}
+	})
+
+	t.Run("asks for a rehash of legacy hashes", func(t *testing.T) {
+		hash, err := legacy.Hash("password")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		needsRehash, err := hasher.Verify(hash, "password")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if !needsRehash {
+			t.Errorf("expected a rehash")
+		}
+	})
+
+	t.Run("errors on wrong password for legacy hashes", func(t *testing.T) {
+		hash, err := legacy.Hash("password")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		needsRehash, err := hasher.Verify(hash, "invalid-password")
+		if !errors.Is(err, ErrPasswordMismatch) {
+			t.Errorf("expected: %v, got: %v", ErrPasswordMismatch, err)
+		}
+		if needsRehash {
+			t.Errorf("expected no rehash")
+		}
+	})
+
+	t.Run("errors on unknown hash formats", func(t *testing.T) {
+		_, err := hasher.Verify("plaintext", "plaintext")
+		if !errors.Is(err, ErrUnsupportedHash) {
+			t.Errorf("expected: %v, got: %v", ErrUnsupportedHash, err)
+		}
+	})
+}
+
+// blockingHasher records how many calls run at once and holds each one until
+// release is closed.
+type blockingHasher struct {
+	mu      sync.Mutex
+	running int
+	peak    int
+	release chan struct{}
+}
+
+func (h *blockingHasher) Hash(password string) (string, error) {
+	h.mu.Lock()
+	h.running++
+	h.peak = max(h.peak, h.running)
+	h.mu.Unlock()
+
+	<-h.release
+
+	h.mu.Lock()
+	h.running--
+	h.mu.Unlock()
+	return password, nil
+}
+
+func (h *blockingHasher) Verify(hash, password string) (bool, error) {
+	_, err := h.Hash(password)
+	return false, err
+}
+
+func TestLimitedHasher(t *testing.T) {
+	heavyHash := "$argon2id$v=19$m=2048,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+
+	var tests = []struct {
+		name     string
+		call     func(h *LimitedHasher)
+		expected int
+	}{
+		{"hashes share the budget", func(h *LimitedHasher) { h.Hash("password") }, 2},
+		{"verify weighs the stored memory cost", func(h *LimitedHasher) { h.Verify(heavyHash, "password") }, 1},
+		{"bcrypt hashes barely count", func(h *LimitedHasher) { h.Verify("$2a$10$abc", "password") }, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &blockingHasher{release: make(chan struct{})}
+			hasher := NewLimitedHasher(inner, 2048, 1024)
+
+			var wg sync.WaitGroup
+			for range 5 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					tt.call(hasher)
+				}()
+			}
+
+			time.Sleep(50 * time.Millisecond)
+			close(inner.release)
+			wg.Wait()
+
+			if inner.peak != tt.expected {
+				t.Errorf("expected at most %d concurrent hashes, got: %d", tt.expected, inner.peak)
+			}
+		})
+	}
+}
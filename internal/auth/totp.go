@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	TOTPIssuer = "Chirpy"
+	TOTPPeriod = 30
+	// TOTPSkew is how many periods before and after the current one are
+	// accepted, to make up for clocks that drift.
+	TOTPSkew = 1
+
+	RecoveryCodeCount  = 10
+	recoveryCodeLength = 10
+)
+
+var totpOptions = totp.ValidateOpts{
+	Period:    TOTPPeriod,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// TOTPKey is a freshly generated TOTP secret with the otpauth:// URI that
+// authenticator apps import.
+type TOTPKey struct {
+	Secret          string
+	ProvisioningURI string
+}
+
+func GenerateTOTPKey(accountName string) (TOTPKey, error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      TOTPIssuer,
+		AccountName: accountName,
+		Period:      TOTPPeriod,
+		Digits:      totpOptions.Digits,
+		Algorithm:   totpOptions.Algorithm,
+	})
+	if err != nil {
+		return TOTPKey{}, err
+	}
+
+	return TOTPKey{Secret: key.Secret(), ProvisioningURI: key.URL()}, nil
+}
+
+// TOTPProvisioningURI rebuilds the otpauth:// URI for a stored secret.
+func TOTPProvisioningURI(secret, accountName string) (string, error) {
+	rawSecret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      TOTPIssuer,
+		AccountName: accountName,
+		Period:      TOTPPeriod,
+		Secret:      rawSecret,
+		Digits:      totpOptions.Digits,
+		Algorithm:   totpOptions.Algorithm,
+	})
+	if err != nil {
+		return "", err
+	}
+	return key.URL(), nil
+}
+
+// TOTPQRCode renders a provisioning URI as a PNG QR code.
+func TOTPQRCode(provisioningURI string, size int) ([]byte, error) {
+	key, err := otp.NewKeyFromURL(provisioningURI)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := key.Image(size, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ValidateTOTPCode checks a code against the secret and returns the time step
+// it belongs to. Callers store the step so the same code can't be used twice.
+func ValidateTOTPCode(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpOptions.Digits.Length() {
+		return 0, false
+	}
+
+	for skew := -TOTPSkew; skew <= TOTPSkew; skew++ {
+		at := now.Add(time.Duration(skew*TOTPPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(secret, at, totpOptions)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return at.Unix() / TOTPPeriod, true
+		}
+	}
+	return 0, false
+}
+
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// GenerateRecoveryCodes returns single-use codes formatted as xxxxx-xxxxx.
+func GenerateRecoveryCodes(count int) ([]string, error) {
+	codes := make([]string, 0, count)
+	for range count {
+		raw := make([]byte, recoveryCodeLength*5/8)
+		_, err := rand.Read(raw)
+		if err != nil {
+			return nil, err
+		}
+		code := recoveryCodeEncoding.EncodeToString(raw)
+		codes = append(codes, code[:recoveryCodeLength/2]+"-"+code[recoveryCodeLength/2:])
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode returns the digest a recovery code is stored under. Case,
+// spaces and dashes are ignored so codes can be typed back loosely.
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(code)
+	normalized = strings.NewReplacer("-", "", " ", "").Replace(normalized)
+	digest := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(digest[:])
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pquerna/otp/totp"
+)
+
+func TestGenerateTOTPKey(t *testing.T) {
+	t.Run("generates a provisioning URI", func(t *testing.T) {
+		key, err := GenerateTOTPKey("user@example.com")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if key.Secret == "" {
+			t.Errorf("expected secret, got empty string")
+		}
+
+		if !strings.HasPrefix(key.ProvisioningURI, "otpauth://totp/Chirpy:user@example.com?") {
+			t.Errorf("unexpected provisioning URI: %s", key.ProvisioningURI)
+		}
+
+		if !strings.Contains(key.ProvisioningURI, "secret="+key.Secret) {
+			t.Errorf("expected provisioning URI to contain the secret: %s", key.ProvisioningURI)
+		}
+	})
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	t.Run("rebuilds the provisioning URI from the secret", func(t *testing.T) {
+		key, err := GenerateTOTPKey("user@example.com")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		uri, err := TOTPProvisioningURI(key.Secret, "user@example.com")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if uri != key.ProvisioningURI {
+			t.Errorf("expected: %s, got: %s", key.ProvisioningURI, uri)
+		}
+	})
+}
+
+func TestTOTPQRCode(t *testing.T) {
+	t.Run("renders a PNG", func(t *testing.T) {
+		key, err := GenerateTOTPKey("user@example.com")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		qrCode, err := TOTPQRCode(key.ProvisioningURI, 200)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		img, err := png.Decode(bytes.NewReader(qrCode))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if img.Bounds().Dx() != 200 {
+			t.Errorf("expected: %d, got: %d", 200, img.Bounds().Dx())
+		}
+	})
+}
+
+func TestValidateTOTPCode(t *testing.T) {
+	key, err := GenerateTOTPKey("user@example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+
+	t.Run("accepts the current code", func(t *testing.T) {
+		code, err := totp.GenerateCodeCustom(key.Secret, now, totpOptions)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		step, ok := ValidateTOTPCode(key.Secret, code, now)
+		if !ok {
+			t.Errorf("expected code to be valid")
+		}
+
+		if step != now.Unix()/TOTPPeriod {
+			t.Errorf("expected: %d, got: %d", now.Unix()/TOTPPeriod, step)
+		}
+	})
+
+	t.Run("accepts the previous code and reports its step", func(t *testing.T) {
+		previous := now.Add(-TOTPPeriod * time.Second)
+		code, err := totp.GenerateCodeCustom(key.Secret, previous, totpOptions)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		step, ok := ValidateTOTPCode(key.Secret, code, now)
+		if !ok {
+			t.Errorf("expected code to be valid")
+		}
+
+		if step != previous.Unix()/TOTPPeriod {
+			t.Errorf("expected: %d, got: %d", previous.Unix()/TOTPPeriod, step)
+		}
+	})
+
+	t.Run("rejects codes outside the skew", func(t *testing.T) {
+		code, err := totp.GenerateCodeCustom(key.Secret, now.Add(-5*TOTPPeriod*time.Second), totpOptions)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		_, ok := ValidateTOTPCode(key.Secret, code, now)
+		if ok {
+			t.Errorf("expected code to be rejected")
+		}
+	})
+
+	t.Run("rejects malformed codes", func(t *testing.T) {
+		for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+			if _, ok := ValidateTOTPCode(key.Secret, code, now); ok {
+				t.Errorf("expected %q to be rejected", code)
+			}
+		}
+	})
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	t.Run("generates unique formatted codes", func(t *testing.T) {
+		codes, err := GenerateRecoveryCodes(RecoveryCodeCount)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if len(codes) != RecoveryCodeCount {
+			t.Errorf("expected: %d, got: %d", RecoveryCodeCount, len(codes))
+		}
+
+		seen := map[string]bool{}
+		for _, code := range codes {
+			if len(code) != recoveryCodeLength+1 || code[recoveryCodeLength/2] != '-' {
+				t.Errorf("unexpected code format: %s", code)
+			}
+			if seen[code] {
+				t.Errorf("duplicate code: %s", code)
+			}
+			seen[code] = true
+		}
+	})
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	t.Run("ignores case, spaces and dashes", func(t *testing.T) {
+		if HashRecoveryCode("abcde-fghij") != HashRecoveryCode(" ABCDE FGHIJ") {
+			t.Errorf("expected the same digest for the same code")
+		}
+	})
+}
+
+func TestValidateChallengeToken(t *testing.T) {
+	keyring := newTestKeyring(t, "test-key")
+	userID := uuid.New()
+
+	t.Run("validates challenge token", func(t *testing.T) {
+		token, err := MakeChallengeToken(userID, keyring, 1*time.Minute)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		validUserID, err := ValidateChallengeToken(token, keyring)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if validUserID != userID {
+			t.Errorf("expected: %s, got: %s", userID, validUserID)
+		}
+	})
+
+	t.Run("errors when a challenge token is used as an access token", func(t *testing.T) {
+		token, err := MakeChallengeToken(userID, keyring, 1*time.Minute)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		_, err = ValidateJWT(token, keyring)
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+
+	t.Run("errors when an access token is used as a challenge token", func(t *testing.T) {
+		token, err := MakeJWT(userID, keyring, 1*time.Minute)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		_, err = ValidateChallengeToken(token, keyring)
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	WebhookTimestampHeader = "X-Polka-Timestamp"
+	WebhookSignatureHeader = "X-Polka-Signature"
+)
+
+var (
+	ErrMissingWebhookSignature = errors.New("missing webhook signature")
+	ErrInvalidWebhookTimestamp = errors.New("invalid webhook timestamp")
+	ErrWebhookTimestampExpired = errors.New("webhook timestamp outside tolerance")
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+)
+
+// SignWebhook returns the hex encoded HMAC-SHA256 of "<timestamp>.<body>".
+func SignWebhook(key string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks that the request was signed by one of keys no
+// more than tolerance away from now. Accepting several keys lets the signing
+// key be rotated without dropping deliveries.
+func VerifyWebhookSignature(headers http.Header, body []byte, keys []string, tolerance time.Duration, now time.Time) error {
+	rawTimestamp := headers.Get(WebhookTimestampHeader)
+	rawSignature := headers.Get(WebhookSignatureHeader)
+	if rawTimestamp == "" || rawSignature == "" {
+		return ErrMissingWebhookSignature
+	}
+
+	timestamp, err := strconv.ParseInt(rawTimestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidWebhookTimestamp
+	}
+
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrWebhookTimestampExpired
+	}
+
+	signature, err := hex.DecodeString(strings.TrimPrefix(rawSignature, "sha256="))
+	if err != nil {
+		return ErrInvalidWebhookSignature
+	}
+
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		expected, _ := hex.DecodeString(SignWebhook(key, timestamp, body))
+		if hmac.Equal(signature, expected) {
+			return nil
+		}
+	}
+
+	return ErrInvalidWebhookSignature
+}
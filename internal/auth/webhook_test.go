@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func signedHeaders(key string, timestamp time.Time, body []byte) http.Header {
+	headers := http.Header{}
+	headers.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+	headers.Set(WebhookSignatureHeader, SignWebhook(key, timestamp.Unix(), body))
+	return headers
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	body := []byte(`{"event":"user.upgraded"}`)
+	now := time.Now()
+	tolerance := 5 * time.Minute
+
+	t.Run("accepts a valid signature", func(t *testing.T) {
+		headers := signedHeaders("key", now, body)
+		err := VerifyWebhookSignature(headers, body, []string{"key"}, tolerance, now)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("accepts a signature made with a rotated key", func(t *testing.T) {
+		headers := signedHeaders("old-key", now, body)
+		err := VerifyWebhookSignature(headers, body, []string{"new-key", "old-key"}, tolerance, now)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	var tests = []struct {
+		name     string
+		headers  http.Header
+		body     []byte
+		expected error
+	}{
+		{
+			"missing headers",
+			http.Header{},
+			body,
+			ErrMissingWebhookSignature,
+		},
+		{
+			"invalid timestamp",
+			http.Header{
+				WebhookTimestampHeader: []string{"yesterday"},
+				WebhookSignatureHeader: []string{"abc"},
+			},
+			body,
+			ErrInvalidWebhookTimestamp,
+		},
+		{
+			"expired timestamp",
+			signedHeaders("key", now.Add(-10*time.Minute), body),
+			body,
+			ErrWebhookTimestampExpired,
+		},
+		{
+			"unknown key",
+			signedHeaders("other-key", now, body),
+			body,
+			ErrInvalidWebhookSignature,
+		},
+		{
+			"tampered body",
+			signedHeaders("key", now, body),
+			[]byte(`{"event":"user.downgraded"}`),
+			ErrInvalidWebhookSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyWebhookSignature(tt.headers, tt.body, []string{"key"}, tolerance, now)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected: %v, got: %v", tt.expected, err)
+			}
+		})
+	}
+}
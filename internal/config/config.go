@@ -1,21 +1,54 @@
 package config
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"sync/atomic"
 
+	"github.com/thihxm/Chirpy/internal/auth"
 	"github.com/thihxm/Chirpy/internal/database"
+	"github.com/thihxm/Chirpy/internal/mailer"
 	"github.com/thihxm/Chirpy/internal/utils"
 )
 
 type ApiConfig struct {
 	FileserverHits atomic.Int32
+	DB             *sql.DB
 	Queries        *database.Queries
-	AuthSecret     string
-	PolkaKey       string
+	// Keyring signs access tokens with its active key and verifies tokens
+	// signed by retired keys until they expire.
+	Keyring *auth.Keyring
+	// PasswordHasher hashes new passwords and verifies stored ones, flagging
+	// hashes that should be upgraded.
+	PasswordHasher auth.PasswordHasher
+	PasswordPolicy auth.PasswordPolicy
+	// PolkaKeys holds every webhook signing key that is currently accepted.
+	// The first one is the active key, the rest are kept during rotation.
+	PolkaKeys []string
+	AdminKey  string
+	Mailer    mailer.Mailer
+	// AppURL is the public address links in emails point to.
+	AppURL string
+}
+
+// InTx runs fn with queries bound to a single transaction, committing if it
+// returns nil and rolling back otherwise.
+func (cfg *ApiConfig) InTx(ctx context.Context, fn func(queries *database.Queries) error) error {
+	tx, err := cfg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(cfg.Queries.WithTx(tx))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (cfg *ApiConfig) MiddlewareMetricsInc(next http.Handler) http.Handler {
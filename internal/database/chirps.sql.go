@@ -7,29 +7,108 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.InReplyTo)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
+	)
+	return i, err
+}
+
+const createQuoteChirp = `-- name: CreateQuoteChirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, quote_of)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of
+`
+
+type CreateQuoteChirpParams struct {
+	Body    string
+	UserID  uuid.UUID
+	QuoteOf uuid.NullUUID
+}
+
+func (q *Queries) CreateQuoteChirp(ctx context.Context, arg CreateQuoteChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createQuoteChirp, arg.Body, arg.UserID, arg.QuoteOf)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
+	)
+	return i, err
+}
+
+const createRechirp = `-- name: CreateRechirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, rechirp_of)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    '',
+    $1,
+    $2
+)
+ON CONFLICT (user_id, rechirp_of) WHERE rechirp_of IS NOT NULL DO NOTHING
+RETURNING id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of
+`
+
+type CreateRechirpParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.NullUUID
+}
+
+func (q *Queries) CreateRechirp(ctx context.Context, arg CreateRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createRechirp, arg.UserID, arg.RechirpOf)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,6 +116,11 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
 	)
 	return i, err
 }
@@ -56,8 +140,95 @@ func (q *Queries) DeleteChirpByID(ctx context.Context, arg DeleteChirpByIDParams
 	return err
 }
 
+const deleteRechirp = `-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1 AND rechirp_of = $2
+`
+
+type DeleteRechirpParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.NullUUID
+}
+
+func (q *Queries) DeleteRechirp(ctx context.Context, arg DeleteRechirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteRechirp, arg.UserID, arg.RechirpOf)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.created_at, parent.updated_at, parent.body, parent.user_id,
+        parent.in_reply_to, parent.deleted_at, parent.rechirp_of, parent.quote_of, 1 AS depth
+    FROM chirps AS child
+    JOIN chirps AS parent ON parent.id = child.in_reply_to
+    WHERE child.id = $1
+    UNION ALL
+    SELECT parent.id, parent.created_at, parent.updated_at, parent.body, parent.user_id,
+        parent.in_reply_to, parent.deleted_at, parent.rechirp_of, parent.quote_of, ancestors.depth + 1
+    FROM chirps AS parent
+    JOIN ancestors ON parent.id = ancestors.in_reply_to
+    WHERE ancestors.depth < $2::int
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, rechirp_of, quote_of
+FROM ancestors
+ORDER BY depth DESC
+`
+
+type GetChirpAncestorsParams struct {
+	ChirpID  uuid.UUID
+	MaxDepth int32
+}
+
+type GetChirpAncestorsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	DeletedAt sql.NullTime
+	RechirpOf uuid.NullUUID
+	QuoteOf   uuid.NullUUID
+}
+
+func (q *Queries) GetChirpAncestors(ctx context.Context, arg GetChirpAncestorsParams) ([]GetChirpAncestorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, arg.ChirpID, arg.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpAncestorsRow
+	for rows.Next() {
+		var i GetChirpAncestorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of
 FROM chirps
 WHERE id = $1
 `
@@ -71,28 +242,170 @@ func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
 	)
 	return i, err
 }
 
-const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id
+const getChirpDescendants = `-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, rechirp_of, quote_of,
+        1 AS depth
+    FROM chirps
+    WHERE in_reply_to = $1
+    UNION ALL
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id,
+        chirps.in_reply_to, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of, descendants.depth + 1
+    FROM chirps
+    JOIN descendants ON chirps.in_reply_to = descendants.id
+    WHERE descendants.depth < $2::int
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, rechirp_of, quote_of
+FROM descendants
+ORDER BY created_at ASC, id ASC
+LIMIT $3
+`
+
+type GetChirpDescendantsParams struct {
+	ChirpID  uuid.UUID
+	MaxDepth int32
+	Limit    int32
+}
+
+type GetChirpDescendantsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	DeletedAt sql.NullTime
+	RechirpOf uuid.NullUUID
+	QuoteOf   uuid.NullUUID
+}
+
+func (q *Queries) GetChirpDescendants(ctx context.Context, arg GetChirpDescendantsParams) ([]GetChirpDescendantsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpDescendants, arg.ChirpID, arg.MaxDepth, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpDescendantsRow
+	for rows.Next() {
+		var i GetChirpDescendantsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpReplies = `-- name: GetChirpReplies :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of
+FROM chirps
+WHERE in_reply_to = $1
+    AND (
+        $2::timestamp IS NULL
+        OR (created_at, id) > ($2::timestamp, $3::uuid)
+    )
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type GetChirpRepliesParams struct {
+	ChirpID         uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) GetChirpReplies(ctx context.Context, arg GetChirpRepliesParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpReplies,
+		arg.ChirpID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsAfter = `-- name: GetChirpsAfter :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of
 FROM chirps
 WHERE (user_id = $1 OR $1 IS NULL)
-ORDER BY CASE 
-    WHEN $2 = 'desc' THEN created_at
-END DESC, CASE 
-    WHEN $2 = 'asc' OR $2 = '' THEN created_at
-END ASC
+    AND deleted_at IS NULL
+    AND (
+        $2::timestamp IS NULL
+        OR (created_at, id) > ($2::timestamp, $3::uuid)
+    )
+ORDER BY created_at ASC, id ASC
+LIMIT $4
 `
 
-type GetChirpsParams struct {
-	AuthorID uuid.NullUUID
-	Sort     interface{}
+type GetChirpsAfterParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
 }
 
-func (q *Queries) GetChirps(ctx context.Context, arg GetChirpsParams) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps, arg.AuthorID, arg.Sort)
+func (q *Queries) GetChirpsAfter(ctx context.Context, arg GetChirpsAfterParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsAfter,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -106,6 +419,11 @@ func (q *Queries) GetChirps(ctx context.Context, arg GetChirpsParams) ([]Chirp,
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
 		); err != nil {
 			return nil, err
 		}
@@ -120,6 +438,199 @@ func (q *Queries) GetChirps(ctx context.Context, arg GetChirpsParams) ([]Chirp,
 	return items, nil
 }
 
+const getChirpsBefore = `-- name: GetChirpsBefore :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of
+FROM chirps
+WHERE (user_id = $1 OR $1 IS NULL)
+    AND deleted_at IS NULL
+    AND (
+        $2::timestamp IS NULL
+        OR (created_at, id) < ($2::timestamp, $3::uuid)
+    )
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type GetChirpsBeforeParams struct {
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) GetChirpsBefore(ctx context.Context, arg GetChirpsBeforeParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsBefore,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of
+FROM chirps
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTimeline = `-- name: GetTimeline :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.in_reply_to, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of
+FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = $1
+    AND chirps.deleted_at IS NULL
+    AND (
+        $2::timestamp IS NULL
+        OR (chirps.created_at, chirps.id) < ($2::timestamp, $3::uuid)
+    )
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $4
+`
+
+type GetTimelineParams struct {
+	UserID          uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) GetTimeline(ctx context.Context, arg GetTimelineParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getTimeline,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const hasChirpReplies = `-- name: HasChirpReplies :one
+SELECT EXISTS (
+    SELECT 1
+    FROM chirps
+    WHERE in_reply_to = $1
+)
+`
+
+func (q *Queries) HasChirpReplies(ctx context.Context, inReplyTo uuid.NullUUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, hasChirpReplies, inReplyTo)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const lockChirpByID = `-- name: LockChirpByID :one
+SELECT id
+FROM chirps
+WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+FOR UPDATE
+`
+
+type LockChirpByIDParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) LockChirpByID(ctx context.Context, arg LockChirpByIDParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, lockChirpByID, arg.ID, arg.UserID)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
 const resetChirps = `-- name: ResetChirps :exec
 DELETE FROM chirps
 `
@@ -128,3 +639,135 @@ func (q *Queries) ResetChirps(ctx context.Context) error {
 	_, err := q.db.ExecContext(ctx, resetChirps)
 	return err
 }
+
+const searchChirps = `-- name: SearchChirps :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of
+FROM chirps
+WHERE search_vector @@ to_tsquery('english', $1)
+    AND deleted_at IS NULL
+    AND (user_id = $2 OR $2 IS NULL)
+ORDER BY ts_rank(search_vector, to_tsquery('english', $1)) DESC, created_at DESC, id DESC
+LIMIT $3
+OFFSET $4
+`
+
+type SearchChirpsParams struct {
+	Query    string
+	AuthorID uuid.NullUUID
+	Limit    int32
+	Offset   int32
+}
+
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps,
+		arg.Query,
+		arg.AuthorID,
+		arg.Limit,
+		arg.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const tombstoneChirpByID = `-- name: TombstoneChirpByID :exec
+WITH deleted_revisions AS (
+    DELETE FROM chirp_revisions
+    USING chirps
+    WHERE chirp_revisions.chirp_id = chirps.id
+        AND chirps.id = $1
+        AND chirps.user_id = $2
+)
+UPDATE chirps
+SET body = '',
+    deleted_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+`
+
+type TombstoneChirpByIDParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) TombstoneChirpByID(ctx context.Context, arg TombstoneChirpByIDParams) error {
+	_, err := q.db.ExecContext(ctx, tombstoneChirpByID, arg.ID, arg.UserID)
+	return err
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+WITH revision AS (
+    INSERT INTO chirp_revisions (id, chirp_id, body, created_at)
+    SELECT gen_random_uuid(), chirps.id, chirps.body, NOW()
+    FROM chirps
+    WHERE chirps.id = $1
+        AND chirps.user_id = $2
+        AND chirps.deleted_at IS NULL
+        AND chirps.created_at > NOW() - $3::int * INTERVAL '1 second'
+)
+UPDATE chirps
+SET body = $4,
+    updated_at = NOW()
+WHERE id = $1
+    AND user_id = $2
+    AND deleted_at IS NULL
+    AND created_at > NOW() - $3::int * INTERVAL '1 second'
+RETURNING id, created_at, updated_at, body, user_id, search_vector, in_reply_to, deleted_at, rechirp_of, quote_of
+`
+
+type UpdateChirpBodyParams struct {
+	ID                uuid.UUID
+	UserID            uuid.UUID
+	EditWindowSeconds int32
+	Body              string
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody,
+		arg.ID,
+		arg.UserID,
+		arg.EditWindowSeconds,
+		arg.Body,
+	)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
+	)
+	return i, err
+}
@@ -6,33 +6,140 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Chirp struct {
-	ID        uuid.UUID
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Body         string
+	UserID       uuid.UUID
+	SearchVector interface{}
+	InReplyTo    uuid.NullUUID
+	DeletedAt    sql.NullTime
+	RechirpOf    uuid.NullUUID
+	QuoteOf      uuid.NullUUID
+}
+
+type ChirpHashtag struct {
+	ChirpID   uuid.UUID
+	Tag       string
 	CreatedAt time.Time
-	UpdatedAt time.Time
+}
+
+type ChirpMention struct {
+	ChirpID     uuid.UUID
+	UserID      uuid.UUID
+	StartOffset int32
+	EndOffset   int32
+	CreatedAt   time.Time
+}
+
+type ChirpRevision struct {
+	ID        uuid.UUID
+	ChirpID   uuid.UUID
 	Body      string
+	CreatedAt time.Time
+}
+
+type ChirpyRedSubscription struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Event       string
+	PeriodStart time.Time
+	PeriodEnd   sql.NullTime
+	CreatedAt   time.Time
+}
+
+type EmailVerificationToken struct {
+	TokenHash string
 	UserID    uuid.UUID
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
 }
 
-type RefreshToken struct {
-	Token     string
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type Like struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
 	CreatedAt time.Time
-	UpdatedAt time.Time
+}
+
+type LoginAttempt struct {
+	Key           string
+	Attempts      int32
+	LastAttemptAt time.Time
+	LockedUntil   sql.NullTime
+}
+
+type PasswordResetToken struct {
+	TokenHash string
 	UserID    uuid.UUID
+	CreatedAt time.Time
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	UsedAt    sql.NullTime
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	TokenHash  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	FamilyID   uuid.UUID
+	UserAgent  string
+	IpAddress  string
+	LastUsedAt time.Time
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID                 uuid.UUID
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	Email              string
+	HashedPassword     string
+	IsChirpyRed        bool
+	Handle             sql.NullString
+	DisplayName        string
+	Bio                string
+	ChirpyRedExpiresAt sql.NullTime
+	TokensValidAfter   sql.NullTime
+	TotpSecret         sql.NullString
+	TotpEnabledAt      sql.NullTime
+	TotpLastUsedStep   sql.NullInt64
+	EmailVerifiedAt    sql.NullTime
+	PendingEmail       sql.NullString
+}
+
+type WebhookEvent struct {
+	ID          uuid.UUID
+	EventID     string
+	Event       string
+	Payload     json.RawMessage
+	Status      string
+	Error       sql.NullString
+	Attempts    int32
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	ProcessedAt sql.NullTime
 }
@@ -7,8 +7,10 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createUser = `-- name: CreateUser :one
@@ -20,7 +22,7 @@ VALUES (
     $1,
     $2
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, chirpy_red_expires_at, tokens_valid_after, totp_secret, totp_enabled_at, totp_last_used_step, email_verified_at, pending_email
 `
 
 type CreateUserParams struct {
@@ -38,12 +40,39 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.ChirpyRedExpiresAt,
+		&i.TokensValidAfter,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastUsedStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
 	)
 	return i, err
 }
 
+const expireChirpRed = `-- name: ExpireChirpRed :execrows
+UPDATE users
+SET is_chirpy_red = false,
+    updated_at = NOW()
+WHERE is_chirpy_red = true
+    AND chirpy_red_expires_at IS NOT NULL
+    AND chirpy_red_expires_at <= NOW()
+`
+
+func (q *Queries) ExpireChirpRed(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, expireChirpRed)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, chirpy_red_expires_at, tokens_valid_after, totp_secret, totp_enabled_at, totp_last_used_step, email_verified_at, pending_email
 FROM users
 WHERE email = $1
 `
@@ -58,10 +87,165 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.ChirpyRedExpiresAt,
+		&i.TokensValidAfter,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastUsedStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+	)
+	return i, err
+}
+
+const getUserByHandle = `-- name: GetUserByHandle :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, chirpy_red_expires_at, tokens_valid_after, totp_secret, totp_enabled_at, totp_last_used_step, email_verified_at, pending_email
+FROM users
+WHERE LOWER(handle) = LOWER($1)
+`
+
+func (q *Queries) GetUserByHandle(ctx context.Context, handle string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByHandle, handle)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.ChirpyRedExpiresAt,
+		&i.TokensValidAfter,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastUsedStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, chirpy_red_expires_at, tokens_valid_after, totp_secret, totp_enabled_at, totp_last_used_step, email_verified_at, pending_email
+FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.ChirpyRedExpiresAt,
+		&i.TokensValidAfter,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastUsedStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
 	)
 	return i, err
 }
 
+const getUserTokensValidAfter = `-- name: GetUserTokensValidAfter :one
+SELECT tokens_valid_after
+FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserTokensValidAfter(ctx context.Context, id uuid.UUID) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, getUserTokensValidAfter, id)
+	var tokens_valid_after sql.NullTime
+	err := row.Scan(&tokens_valid_after)
+	return tokens_valid_after, err
+}
+
+const getUsersByHandles = `-- name: GetUsersByHandles :many
+SELECT id, handle
+FROM users
+WHERE LOWER(handle) = ANY($1::text[])
+`
+
+type GetUsersByHandlesRow struct {
+	ID     uuid.UUID
+	Handle sql.NullString
+}
+
+func (q *Queries) GetUsersByHandles(ctx context.Context, handles []string) ([]GetUsersByHandlesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersByHandles, pq.Array(handles))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersByHandlesRow
+	for rows.Next() {
+		var i GetUsersByHandlesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Handle,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const invalidateUserTokens = `-- name: InvalidateUserTokens :exec
+UPDATE users
+SET tokens_valid_after = $2,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type InvalidateUserTokensParams struct {
+	ID               uuid.UUID
+	TokensValidAfter sql.NullTime
+}
+
+func (q *Queries) InvalidateUserTokens(ctx context.Context, arg InvalidateUserTokensParams) error {
+	_, err := q.db.ExecContext(ctx, invalidateUserTokens, arg.ID, arg.TokensValidAfter)
+	return err
+}
+
+const rehashUserPassword = `-- name: RehashUserPassword :exec
+UPDATE users
+SET hashed_password = $1
+WHERE id = $2
+    AND hashed_password = $3
+`
+
+type RehashUserPasswordParams struct {
+	NewHashedPassword string
+	ID                uuid.UUID
+	OldHashedPassword string
+}
+
+func (q *Queries) RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, rehashUserPassword, arg.NewHashedPassword, arg.ID, arg.OldHashedPassword)
+	return err
+}
+
 const resetUsers = `-- name: ResetUsers :exec
 DELETE FROM users
 `
@@ -71,23 +255,73 @@ func (q *Queries) ResetUsers(ctx context.Context) error {
 	return err
 }
 
+const setPendingEmail = `-- name: SetPendingEmail :one
+UPDATE users
+SET pending_email = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, chirpy_red_expires_at, tokens_valid_after, totp_secret, totp_enabled_at, totp_last_used_step, email_verified_at, pending_email
+`
+
+type SetPendingEmailParams struct {
+	ID           uuid.UUID
+	PendingEmail sql.NullString
+}
+
+func (q *Queries) SetPendingEmail(ctx context.Context, arg SetPendingEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setPendingEmail, arg.ID, arg.PendingEmail)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.ChirpyRedExpiresAt,
+		&i.TokensValidAfter,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastUsedStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+	)
+	return i, err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
-SET email = $1,
-    hashed_password = $2,
+SET email = COALESCE($1, email),
+    hashed_password = COALESCE($2, hashed_password),
+    handle = COALESCE($3, handle),
+    display_name = COALESCE($4, display_name),
+    bio = COALESCE($5, bio),
     updated_at = NOW()
-WHERE id = $3
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+WHERE id = $6
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, chirpy_red_expires_at, tokens_valid_after, totp_secret, totp_enabled_at, totp_last_used_step, email_verified_at, pending_email
 `
 
 type UpdateUserParams struct {
-	Email          string
-	HashedPassword string
+	Email          sql.NullString
+	HashedPassword sql.NullString
+	Handle         sql.NullString
+	DisplayName    sql.NullString
+	Bio            sql.NullString
 	ID             uuid.UUID
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.Email, arg.HashedPassword, arg.ID)
+	row := q.db.QueryRowContext(ctx, updateUser,
+		arg.Email,
+		arg.HashedPassword,
+		arg.Handle,
+		arg.DisplayName,
+		arg.Bio,
+		arg.ID,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -96,6 +330,16 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.ChirpyRedExpiresAt,
+		&i.TokensValidAfter,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastUsedStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
 	)
 	return i, err
 }
@@ -103,18 +347,60 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 const upgradeToChirpRed = `-- name: UpgradeToChirpRed :one
 UPDATE users
 SET is_chirpy_red = $1,
+    chirpy_red_expires_at = $2,
     updated_at = NOW()
-WHERE id = $2
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+WHERE id = $3
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, chirpy_red_expires_at, tokens_valid_after, totp_secret, totp_enabled_at, totp_last_used_step, email_verified_at, pending_email
 `
 
 type UpgradeToChirpRedParams struct {
-	IsChirpyRed bool
-	ID          uuid.UUID
+	IsChirpyRed        bool
+	ChirpyRedExpiresAt sql.NullTime
+	ID                 uuid.UUID
 }
 
 func (q *Queries) UpgradeToChirpRed(ctx context.Context, arg UpgradeToChirpRedParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, upgradeToChirpRed, arg.IsChirpyRed, arg.ID)
+	row := q.db.QueryRowContext(ctx, upgradeToChirpRed, arg.IsChirpyRed, arg.ChirpyRedExpiresAt, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.ChirpyRedExpiresAt,
+		&i.TokensValidAfter,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastUsedStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+	)
+	return i, err
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE users
+SET email = $1,
+    email_verified_at = NOW(),
+    pending_email = CASE WHEN pending_email = $1 THEN NULL ELSE pending_email END,
+    updated_at = NOW()
+WHERE id = $2
+    AND (email = $1 OR pending_email = $1)
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, chirpy_red_expires_at, tokens_valid_after, totp_secret, totp_enabled_at, totp_last_used_step, email_verified_at, pending_email
+`
+
+type VerifyUserEmailParams struct {
+	Email string
+	ID    uuid.UUID
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserEmail, arg.Email, arg.ID)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -123,6 +409,16 @@ func (q *Queries) UpgradeToChirpRed(ctx context.Context, arg UpgradeToChirpRedPa
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.ChirpyRedExpiresAt,
+		&i.TokensValidAfter,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastUsedStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
 	)
 	return i, err
 }
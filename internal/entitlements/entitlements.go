@@ -0,0 +1,59 @@
+package entitlements
+
+import (
+	"time"
+	"unicode/utf8"
+)
+
+type Plan string
+
+const (
+	PlanFree Plan = "free"
+	PlanRed  Plan = "chirpy_red"
+)
+
+// Entitlements describes what a user's plan allows them to do. Handlers must
+// check these instead of hard-coding limits.
+type Entitlements struct {
+	Plan           Plan
+	MaxChirpLength int
+	// EditWindow is how long after posting a chirp can still be edited. Zero
+	// means the plan can't edit chirps at all.
+	EditWindow time.Duration
+}
+
+var plans = map[Plan]Entitlements{
+	PlanFree: {
+		Plan:           PlanFree,
+		MaxChirpLength: 140,
+		EditWindow:     5 * time.Minute,
+	},
+	PlanRed: {
+		Plan:           PlanRed,
+		MaxChirpLength: 500,
+		EditWindow:     30 * time.Minute,
+	},
+}
+
+func ForPlan(plan Plan) Entitlements {
+	entitlements, ok := plans[plan]
+	if !ok {
+		return plans[PlanFree]
+	}
+	return entitlements
+}
+
+func ForUser(isChirpyRed bool) Entitlements {
+	if isChirpyRed {
+		return ForPlan(PlanRed)
+	}
+	return ForPlan(PlanFree)
+}
+
+func (e Entitlements) ChirpTooLong(body string) bool {
+	return utf8.RuneCountInString(body) > e.MaxChirpLength
+}
+
+func (e Entitlements) CanEditChirps() bool {
+	return e.EditWindow > 0
+}
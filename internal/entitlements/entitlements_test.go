@@ -0,0 +1,74 @@
+package entitlements
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestForPlan(t *testing.T) {
+	var tests = []struct {
+		name           string
+		plan           Plan
+		expectedPlan   Plan
+		maxChirpLength int
+		editWindow     time.Duration
+	}{
+		{"free", PlanFree, PlanFree, 140, 5 * time.Minute},
+		{"chirpy red", PlanRed, PlanRed, 500, 30 * time.Minute},
+		{"unknown plan falls back to free", Plan("gold"), PlanFree, 140, 5 * time.Minute},
+		{"empty plan falls back to free", Plan(""), PlanFree, 140, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entitlements := ForPlan(tt.plan)
+			if entitlements.Plan != tt.expectedPlan {
+				t.Errorf("expected plan: %v, got: %v", tt.expectedPlan, entitlements.Plan)
+			}
+			if entitlements.MaxChirpLength != tt.maxChirpLength {
+				t.Errorf("expected max chirp length: %v, got: %v", tt.maxChirpLength, entitlements.MaxChirpLength)
+			}
+			if entitlements.EditWindow != tt.editWindow {
+				t.Errorf("expected edit window: %v, got: %v", tt.editWindow, entitlements.EditWindow)
+			}
+			if entitlements.CanEditChirps() != (tt.editWindow > 0) {
+				t.Errorf("expected can edit chirps: %v, got: %v", tt.editWindow > 0, entitlements.CanEditChirps())
+			}
+		})
+	}
+}
+
+func TestForUser(t *testing.T) {
+	if plan := ForUser(false).Plan; plan != PlanFree {
+		t.Errorf("expected: %v, got: %v", PlanFree, plan)
+	}
+	if plan := ForUser(true).Plan; plan != PlanRed {
+		t.Errorf("expected: %v, got: %v", PlanRed, plan)
+	}
+}
+
+func TestChirpTooLong(t *testing.T) {
+	var tests = []struct {
+		name     string
+		plan     Plan
+		body     string
+		expected bool
+	}{
+		{"free at the limit", PlanFree, strings.Repeat("a", 140), false},
+		{"free over the limit", PlanFree, strings.Repeat("a", 141), true},
+		{"red over the free limit", PlanRed, strings.Repeat("a", 141), false},
+		{"red over its limit", PlanRed, strings.Repeat("a", 501), true},
+		// Length is counted in characters, not bytes.
+		{"multibyte at the limit", PlanFree, strings.Repeat("é", 140), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tooLong := ForPlan(tt.plan).ChirpTooLong(tt.body)
+			if tooLong != tt.expected {
+				t.Errorf("expected: %v, got: %v", tt.expected, tooLong)
+			}
+		})
+	}
+}
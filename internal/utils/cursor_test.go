@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEncodeDecodeCursor(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 12, 30, 45, 123456789, time.FixedZone("BRT", -3*60*60))
+	id := uuid.New()
+
+	gotCreatedAt, gotID, err := DecodeCursor(EncodeCursor(createdAt, id))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !gotCreatedAt.Equal(createdAt) {
+		t.Errorf("expected created_at %v, got %v", createdAt, gotCreatedAt)
+	}
+	if gotID != id {
+		t.Errorf("expected id %v, got %v", id, gotID)
+	}
+}
+
+func TestDecodeCursorRejectsMalformedInput(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	id := uuid.New().String()
+
+	var tests = []struct {
+		name   string
+		cursor string
+	}{
+		{"empty", ""},
+		{"invalid base64", "not base64!"},
+		{"missing separator", encode("2024-03-01T12:00:00Z")},
+		{"too many parts", encode("2024-03-01T12:00:00Z|" + id + "|extra")},
+		{"bad timestamp", encode("yesterday|" + id)},
+		{"timestamp without zone", encode("2024-03-01T12:00:00|" + id)},
+		{"bad id", encode("2024-03-01T12:00:00Z|not-a-uuid")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := DecodeCursor(tt.cursor)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("expected: %v, got: %v", ErrInvalidCursor, err)
+			}
+		})
+	}
+}
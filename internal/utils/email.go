@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+const MaxEmailLength = 254
+
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// ValidateEmail accepts a bare address such as user@example.com. Display
+// names and other RFC 5322 extras are rejected.
+func ValidateEmail(email string) error {
+	if len(email) > MaxEmailLength {
+		return ErrInvalidEmail
+	}
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email {
+		return ErrInvalidEmail
+	}
+
+	_, domain, _ := strings.Cut(address.Address, "@")
+	if !strings.Contains(domain, ".") {
+		return ErrInvalidEmail
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateEmail(t *testing.T) {
+	var tests = []struct {
+		name     string
+		email    string
+		expected error
+	}{
+		{"plain address", "user@example.com", nil},
+		{"subaddress", "user+chirpy@example.com", nil},
+		{"subdomain", "user@mail.example.co.uk", nil},
+		{"empty", "", ErrInvalidEmail},
+		{"missing at", "user.example.com", ErrInvalidEmail},
+		{"missing local part", "@example.com", ErrInvalidEmail},
+		{"missing domain", "user@", ErrInvalidEmail},
+		{"domain without a dot", "user@localhost", ErrInvalidEmail},
+		{"display name", "User <user@example.com>", ErrInvalidEmail},
+		{"angle brackets", "<user@example.com>", ErrInvalidEmail},
+		{"surrounding spaces", " user@example.com ", ErrInvalidEmail},
+		{"two addresses", "a@example.com, b@example.com", ErrInvalidEmail},
+		{"too long", strings.Repeat("a", MaxEmailLength) + "@example.com", ErrInvalidEmail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEmail(tt.email)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected: %v, got: %v", tt.expected, err)
+			}
+		})
+	}
+}
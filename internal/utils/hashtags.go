@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+const MaxHashtagLength = 64
+
+var hashtagRegexp = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&])#([\p{L}\p{N}_]+)`)
+
+// ExtractHashtags returns the distinct, normalized hashtags found in body in
+// the order they first appear.
+func ExtractHashtags(body string) []string {
+	seen := map[string]bool{}
+	tags := []string{}
+
+	for _, match := range hashtagRegexp.FindAllStringSubmatch(body, -1) {
+		tag := NormalizeHashtag(match[1])
+		if tag == "" || len(tag) > MaxHashtagLength || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+func NormalizeHashtag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(tag, "#"))
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	var tests = []struct {
+		name     string
+		body     string
+		expected []string
+	}{
+		{"no hashtags", "just a chirp", []string{}},
+		{"single hashtag", "learning #golang today", []string{"golang"}},
+		{"hashtag at start", "#chirpy is live", []string{"chirpy"}},
+		{"lowercased", "#GoLang", []string{"golang"}},
+		{"deduplicated in order", "#go #rust #GO #go", []string{"go", "rust"}},
+		{"unicode letters", "#café com #pão", []string{"café", "pão"}},
+		{"underscores and digits", "#go_1_22", []string{"go_1_22"}},
+		{"stops at punctuation", "#go, #rust!", []string{"go", "rust"}},
+		{"ignored inside words", "email#tag and foo_#bar", []string{}},
+		{"ignored in html entities", "&#39;quoted&#39;", []string{}},
+		{"bare hash", "# and ##", []string{}},
+		{"too long", "#" + strings.Repeat("a", MaxHashtagLength+1), []string{}},
+		{"longest allowed", "#" + strings.Repeat("a", MaxHashtagLength), []string{strings.Repeat("a", MaxHashtagLength)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags := ExtractHashtags(tt.body)
+			if !slices.Equal(tags, tt.expected) {
+				t.Errorf("expected: %v, got: %v", tt.expected, tags)
+			}
+		})
+	}
+}
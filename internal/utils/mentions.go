@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// mentionRegexp matches the handle characters after an @. RE2 has no
+// lookahead and \b only knows ASCII, so ExtractMentions checks the character
+// that follows itself.
+var mentionRegexp = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])(@([A-Za-z0-9_]{1,30}))`)
+
+type Mention struct {
+	Handle string
+	// Start and End are offsets in Unicode code points into the chirp body,
+	// covering the handle including its leading @.
+	Start int
+	End   int
+}
+
+// ExtractMentions returns every @handle in body. Handles are lowercased so
+// they can be matched case-insensitively against users.
+func ExtractMentions(body string) []Mention {
+	mentions := []Mention{}
+
+	for _, match := range mentionRegexp.FindAllStringSubmatchIndex(body, -1) {
+		start, end := match[2], match[3]
+		// "@joão" is not a mention of @jo, and a handle over the length
+		// limit is not a mention of its first 30 characters.
+		if next, _ := utf8.DecodeRuneInString(body[end:]); isHandleContinuation(next) {
+			continue
+		}
+		mentions = append(mentions, Mention{
+			Handle: NormalizeHandle(body[match[4]:match[5]]),
+			Start:  utf8.RuneCountInString(body[:start]),
+			End:    utf8.RuneCountInString(body[:end]),
+		})
+	}
+
+	return mentions
+}
+
+func isHandleContinuation(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r)
+}
+
+func NormalizeHandle(handle string) string {
+	return strings.ToLower(strings.TrimPrefix(handle, "@"))
+}
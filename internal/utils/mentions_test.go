@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExtractMentions(t *testing.T) {
+	var tests = []struct {
+		name     string
+		body     string
+		expected []Mention
+	}{
+		{"no mentions", "just a chirp", []Mention{}},
+		{"single mention", "hi @alice", []Mention{{Handle: "alice", Start: 3, End: 9}}},
+		{"mention at start", "@bob hello", []Mention{{Handle: "bob", Start: 0, End: 4}}},
+		{"lowercased", "@Alice_99", []Mention{{Handle: "alice_99", Start: 0, End: 9}}},
+		{
+			"repeated mentions keep their offsets",
+			"@a and @a",
+			[]Mention{{Handle: "a", Start: 0, End: 2}, {Handle: "a", Start: 7, End: 9}},
+		},
+		{"offsets after multibyte text", "olá @joao", []Mention{{Handle: "joao", Start: 4, End: 9}}},
+		{"stops at punctuation", "@alice, hi", []Mention{{Handle: "alice", Start: 0, End: 6}}},
+		{"ignored in email addresses", "mail alice@example.com", []Mention{}},
+		{"ignored after another @", "@@alice", []Mention{}},
+		{"bare @", "meet @ noon", []Mention{}},
+		{"handle too long", "@abcdefghijklmnopqrstuvwxyz012345", []Mention{}},
+		{"non-ASCII letter in the handle", "oi @joão", []Mention{}},
+		{"combining mark in the handle", "oi @joa\u0303o", []Mention{}},
+		{"non-ASCII letter after a mention", "@joão @joao", []Mention{{Handle: "joao", Start: 6, End: 11}}},
+		{"adjacent mentions", "@a @b", []Mention{{Handle: "a", Start: 0, End: 2}, {Handle: "b", Start: 3, End: 5}}},
+		{"followed by another @", "@alice@example", []Mention{{Handle: "alice", Start: 0, End: 6}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mentions := ExtractMentions(tt.body)
+			if !slices.Equal(mentions, tt.expected) {
+				t.Errorf("expected: %v, got: %v", tt.expected, mentions)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"unicode/utf8"
+)
+
+const (
+	MaxDisplayNameLength = 50
+	MaxBioLength         = 160
+)
+
+var (
+	ErrInvalidHandle      = errors.New("handle must be 3 to 30 letters, digits or underscores")
+	ErrReservedHandle     = errors.New("handle is reserved")
+	ErrDisplayNameTooLong = errors.New("display name is too long")
+	ErrBioTooLong         = errors.New("bio is too long")
+)
+
+var handleRegexp = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// reservedHandles can't be claimed because they clash with routes such as
+// /api/users/me.
+var reservedHandles = map[string]bool{
+	"me":     true,
+	"admin":  true,
+	"chirpy": true,
+}
+
+func ValidateHandle(handle string) error {
+	if !handleRegexp.MatchString(handle) {
+		return ErrInvalidHandle
+	}
+	if reservedHandles[NormalizeHandle(handle)] {
+		return ErrReservedHandle
+	}
+	return nil
+}
+
+func ValidateDisplayName(displayName string) error {
+	if utf8.RuneCountInString(displayName) > MaxDisplayNameLength {
+		return ErrDisplayNameTooLong
+	}
+	return nil
+}
+
+func ValidateBio(bio string) error {
+	if utf8.RuneCountInString(bio) > MaxBioLength {
+		return ErrBioTooLong
+	}
+	return nil
+}
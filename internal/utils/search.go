@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var ErrEmptySearchQuery = errors.New("empty search query")
+
+var searchWordRegexp = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// BuildTSQuery turns a user search string into a to_tsquery expression.
+// Quoted text becomes a phrase query, a trailing * on a word makes it a prefix
+// query and every other word must match. Anything that is not a letter or a
+// digit is dropped, so the result is always valid tsquery syntax.
+func BuildTSQuery(query string) (string, error) {
+	terms := []string{}
+
+	for i, part := range strings.Split(query, `"`) {
+		if i%2 == 1 {
+			words := searchWordRegexp.FindAllString(part, -1)
+			if len(words) > 0 {
+				terms = append(terms, "("+strings.Join(words, " <-> ")+")")
+			}
+			continue
+		}
+
+		for _, field := range strings.Fields(part) {
+			words := searchWordRegexp.FindAllString(field, -1)
+			if len(words) == 0 {
+				continue
+			}
+			if strings.HasSuffix(field, "*") {
+				words[len(words)-1] += ":*"
+			}
+			terms = append(terms, words...)
+		}
+	}
+
+	if len(terms) == 0 {
+		return "", ErrEmptySearchQuery
+	}
+
+	return strings.Join(terms, " & "), nil
+}
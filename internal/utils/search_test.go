@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBuildTSQuery(t *testing.T) {
+	var tests = []struct {
+		name          string
+		query         string
+		expected      string
+		expectedError error
+	}{
+		{"single word", "hello", "hello", nil},
+		{"every word must match", "hello world", "hello & world", nil},
+		{"phrase", `"hello world"`, "(hello <-> world)", nil},
+		{"phrase and word", `"big cat" dog`, "(big <-> cat) & dog", nil},
+		{"unclosed phrase", `"hello world`, "(hello <-> world)", nil},
+		{"prefix", "cat*", "cat:*", nil},
+		{"prefix after punctuation", "cat!*", "cat:*", nil},
+		{"star inside a phrase is dropped", `"cat*"`, "(cat)", nil},
+		{"tsquery operators are dropped", "foo & | ! ( ) <-> bar", "foo & bar", nil},
+		{"punctuation splits words", "it's foo!@#bar", "it & s & foo & bar", nil},
+		{"tsquery weights are dropped", "foo:* bar:a", "foo:* & bar & a", nil},
+		{"non-ASCII letters", "café olá", "café & olá", nil},
+		{"empty", "", "", ErrEmptySearchQuery},
+		{"only punctuation", "!!! *** :*", "", ErrEmptySearchQuery},
+		{"empty phrase", `""`, "", ErrEmptySearchQuery},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tsQuery, err := BuildTSQuery(tt.query)
+			if !errors.Is(err, tt.expectedError) {
+				t.Errorf("expected error: %v, got: %v", tt.expectedError, err)
+			}
+			if tsQuery != tt.expected {
+				t.Errorf("expected: %q, got: %q", tt.expected, tsQuery)
+			}
+		})
+	}
+}
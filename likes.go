@@ -0,0 +1,103 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/thihxm/Chirpy/internal/config"
+	"github.com/thihxm/Chirpy/internal/database"
+	"github.com/thihxm/Chirpy/internal/utils"
+)
+
+// withLikeStats fills LikeCount and LikedByMe for every chirp using a single
+// query, so list endpoints don't pay one round trip per chirp.
+func withLikeStats(r *http.Request, cfg *config.ApiConfig, chirps []Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(chirps))
+	for i, chirp := range chirps {
+		ids[i] = chirp.ID
+	}
+
+	stats, err := cfg.Queries.GetChirpLikeStats(r.Context(), database.GetChirpLikeStatsParams{
+		ViewerID: viewerIDFromContext(r.Context()),
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+
+	statsByID := make(map[uuid.UUID]database.GetChirpLikeStatsRow, len(stats))
+	for _, stat := range stats {
+		statsByID[stat.ChirpID] = stat
+	}
+
+	for i := range chirps {
+		stat := statsByID[chirps[i].ID]
+		chirps[i].LikeCount = stat.LikeCount
+		chirps[i].LikedByMe = stat.LikedByMe
+	}
+
+	return nil
+}
+
+func likeChirpHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawID := r.PathValue("chirpID")
+
+		id, err := uuid.Parse(rawID)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+			return
+		}
+
+		chirp, err := cfg.Queries.GetChirpByID(r.Context(), id)
+		if err != nil || chirp.DeletedAt.Valid {
+			utils.RespondWithError(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+
+		userID := r.Context().Value(userIDKey).(uuid.UUID)
+
+		err = cfg.Queries.LikeChirp(r.Context(), database.LikeChirpParams{
+			UserID:  userID,
+			ChirpID: id,
+		})
+		if err != nil {
+			log.Printf("Error liking chirp: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusNoContent, nil)
+	})
+}
+
+func unlikeChirpHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawID := r.PathValue("chirpID")
+
+		id, err := uuid.Parse(rawID)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+			return
+		}
+
+		userID := r.Context().Value(userIDKey).(uuid.UUID)
+
+		err = cfg.Queries.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+			UserID:  userID,
+			ChirpID: id,
+		})
+		if err != nil {
+			log.Printf("Error unliking chirp: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusNoContent, nil)
+	})
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thihxm/Chirpy/internal/auth"
+	"github.com/thihxm/Chirpy/internal/config"
+	"github.com/thihxm/Chirpy/internal/database"
+	"github.com/thihxm/Chirpy/internal/utils"
+)
+
+const (
+	LOGIN_FAILED_MESSAGE          = "Incorrect email or password"
+	LOGIN_ATTEMPTS_CLEAN_INTERVAL = 10 * time.Minute
+)
+
+var accountLockoutPolicy = auth.LockoutPolicy{
+	FreeAttempts:     3,
+	BaseDelay:        1 * time.Second,
+	MaxDelay:         5 * time.Minute,
+	LockoutThreshold: 10,
+	LockoutDuration:  15 * time.Minute,
+	Window:           1 * time.Hour,
+}
+
+// ipLockoutPolicy is looser than the account one because many users can
+// share an address behind a NAT.
+var ipLockoutPolicy = auth.LockoutPolicy{
+	FreeAttempts:     20,
+	BaseDelay:        1 * time.Second,
+	MaxDelay:         1 * time.Minute,
+	LockoutThreshold: 100,
+	LockoutDuration:  15 * time.Minute,
+	Window:           1 * time.Hour,
+}
+
+type loginAttemptKey struct {
+	key    string
+	policy auth.LockoutPolicy
+}
+
+// loginAttemptKeys returns the counters a login attempt is tracked under.
+// Accounts are keyed by the email that was typed, so unknown emails are
+// throttled exactly like existing ones.
+func loginAttemptKeys(r *http.Request, email string) []loginAttemptKey {
+	return []loginAttemptKey{
+		{key: "account:" + strings.ToLower(strings.TrimSpace(email)), policy: accountLockoutPolicy},
+		{key: "ip:" + clientIP(r), policy: ipLockoutPolicy},
+	}
+}
+
+var errLoginLocked = errors.New("login is locked")
+
+// respondIfLoginLocked counts a login attempt against each of its counters
+// before the credentials are checked, and rejects it when any of them is in
+// a backoff or lockout period. Each counter row stays locked until its
+// backoff is decided, so concurrent guesses are counted one after another
+// instead of all getting in before the first failure is recorded. Rejected
+// attempts aren't counted.
+func respondIfLoginLocked(w http.ResponseWriter, r *http.Request, cfg *config.ApiConfig, keys []loginAttemptKey) bool {
+	var lockedUntil time.Time
+	err := cfg.InTx(r.Context(), func(queries *database.Queries) error {
+		for _, key := range keys {
+			attempt, err := queries.RecordLoginAttempt(r.Context(), database.RecordLoginAttemptParams{
+				Key:         key.key,
+				WindowStart: time.Now().Add(-key.policy.Window),
+			})
+			if err != nil {
+				return err
+			}
+			if attempt.LockedUntil.Valid && attempt.LockedUntil.Time.After(time.Now()) {
+				lockedUntil = attempt.LockedUntil.Time
+				return errLoginLocked
+			}
+
+			delay := key.policy.Delay(int(attempt.Attempts))
+			if delay == 0 {
+				continue
+			}
+
+			err = queries.LockLogin(r.Context(), database.LockLoginParams{
+				Key:         key.key,
+				LockedUntil: sql.NullTime{Time: time.Now().Add(delay), Valid: true},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errLoginLocked) {
+		retryAfter := int(time.Until(lockedUntil).Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+		utils.RespondWithError(w, http.StatusTooManyRequests, "Too many login attempts, try again later")
+		return true
+	}
+	if err != nil {
+		log.Printf("Error recording login attempt: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+		return true
+	}
+	return false
+}
+
+// clearLoginFailures forgets the account's attempts after a successful
+// login. The IP counter only takes back the attempt that succeeded,
+// otherwise logging in to an account of their own would let an attacker
+// reset it.
+func clearLoginFailures(ctx context.Context, cfg *config.ApiConfig, keys []loginAttemptKey) {
+	err := cfg.Queries.ClearLoginAttempts(ctx, keys[0].key)
+	if err != nil {
+		log.Printf("Error clearing login attempts: %v", err)
+	}
+
+	for _, key := range keys[1:] {
+		err = cfg.Queries.ForgiveLoginAttempt(ctx, key.key)
+		if err != nil {
+			log.Printf("Error clearing login attempts: %v", err)
+		}
+	}
+}
+
+var (
+	dummyPasswordHashOnce sync.Once
+	dummyPasswordHashed   string
+)
+
+// dummyPasswordHash is verified against when the email is unknown, so the
+// response takes as long as it does for a wrong password.
+func dummyPasswordHash(cfg *config.ApiConfig) string {
+	dummyPasswordHashOnce.Do(func() {
+		hashedPassword, err := cfg.PasswordHasher.Hash("chirpy-dummy-password")
+		if err != nil {
+			log.Printf("Error hashing dummy password: %v", err)
+		}
+		dummyPasswordHashed = hashedPassword
+	})
+	return dummyPasswordHashed
+}
+
+func cleanupLoginAttemptsPeriodically(cfg *config.ApiConfig, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		window := max(accountLockoutPolicy.Window, ipLockoutPolicy.Window)
+		deleted, err := cfg.Queries.DeleteStaleLoginAttempts(context.Background(), time.Now().Add(-window))
+		if err != nil {
+			log.Printf("Error cleaning up login attempts: %v", err)
+			continue
+		}
+		if deleted > 0 {
+			log.Printf("Cleaned up %d login attempt counters", deleted)
+		}
+	}
+}
@@ -2,21 +2,80 @@ package main
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"github.com/thihxm/Chirpy/internal/auth"
 	"github.com/thihxm/Chirpy/internal/config"
 	"github.com/thihxm/Chirpy/internal/database"
+	"github.com/thihxm/Chirpy/internal/mailer"
 )
 
 func main() {
 	godotenv.Load()
 	dbURL := os.Getenv("DB_URL")
-	authSecret := os.Getenv("AUTH_SECRET")
-	polkaKey := os.Getenv("POLKA_KEY")
+	adminKey := os.Getenv("ADMIN_KEY")
+	polkaKeys := strings.Split(os.Getenv("POLKA_KEYS"), ",")
+	if os.Getenv("POLKA_KEYS") == "" {
+		polkaKeys = []string{os.Getenv("POLKA_KEY")}
+	}
+	for i, key := range polkaKeys {
+		polkaKeys[i] = strings.TrimSpace(key)
+	}
+
+	keyring, err := loadKeyring(os.Getenv("JWT_SIGNING_KEYS"), os.Getenv("PLATFORM"))
+	if err != nil {
+		log.Fatalf("Error loading JWT signing keys: %v", err)
+		return
+	}
+
+	tokenOptions := auth.DefaultTokenOptions()
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		tokenOptions.Audience = audience
+	}
+	if algorithms := os.Getenv("JWT_ALGORITHMS"); algorithms != "" {
+		tokenOptions.Algorithms = strings.Split(algorithms, ",")
+		for i, algorithm := range tokenOptions.Algorithms {
+			tokenOptions.Algorithms[i] = strings.TrimSpace(algorithm)
+		}
+	}
+	err = keyring.SetTokenOptions(tokenOptions)
+	if err != nil {
+		log.Fatalf("Error configuring JWT validation: %v", err)
+		return
+	}
+
+	passwordPolicy, err := loadPasswordPolicy()
+	if err != nil {
+		log.Fatalf("Error loading password policy: %v", err)
+		return
+	}
+
+	passwordHasher, err := loadPasswordHasher()
+	if err != nil {
+		log.Fatalf("Error configuring password hashing: %v", err)
+		return
+	}
+
+	appURL := strings.TrimSuffix(os.Getenv("APP_URL"), "/")
+	if appURL == "" {
+		appURL = "http://localhost:8080"
+	}
+
+	mail, err := loadMailer(os.Getenv("PLATFORM"))
+	if err != nil {
+		log.Fatalf("Error configuring email: %v", err)
+		return
+	}
 
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
@@ -27,9 +86,15 @@ func main() {
 
 	mux := http.NewServeMux()
 	cfg := &config.ApiConfig{
-		Queries:    dbQueries,
-		AuthSecret: authSecret,
-		PolkaKey:   polkaKey,
+		DB:             db,
+		Queries:        dbQueries,
+		Keyring:        keyring,
+		PasswordHasher: passwordHasher,
+		PasswordPolicy: passwordPolicy,
+		PolkaKeys:      polkaKeys,
+		AdminKey:       adminKey,
+		Mailer:         mail,
+		AppURL:         appURL,
 	}
 
 	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
@@ -37,8 +102,11 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
+	mux.Handle("GET /.well-known/jwks.json", jwksHandler(cfg))
 	mux.HandleFunc("POST /admin/reset", cfg.Reset)
 	mux.HandleFunc("GET /admin/metrics", cfg.Metrics)
+	mux.Handle("GET /admin/webhooks", middlewareIsAdmin(cfg, listWebhookEventsHandler(cfg)))
+	mux.Handle("POST /admin/webhooks/{eventID}/replay", middlewareIsAdmin(cfg, replayWebhookEventHandler(cfg)))
 	mux.Handle("/app/", cfg.MiddlewareMetricsInc(http.StripPrefix("/app/", http.FileServer(http.Dir(".")))))
 
 	server := &http.Server{
@@ -49,17 +117,172 @@ func main() {
 	mux.Handle("POST /api/users", createUserHandler(cfg))
 	mux.Handle("PUT /api/users", middlewareIsAuthenticated(cfg, updateUserHandler(cfg)))
 
+	mux.Handle("GET /api/users/{handleOrID}", getUserProfileHandler(cfg))
+	mux.Handle("GET /api/users/me/entitlements", middlewareIsAuthenticated(cfg, getMyEntitlementsHandler(cfg)))
+	mux.Handle("GET /api/users/me/mentions", middlewareIsAuthenticated(cfg, getMyMentionsHandler(cfg)))
+	mux.Handle("POST /api/users/me/2fa/totp", middlewareIsAuthenticated(cfg, enrollTOTPHandler(cfg)))
+	mux.Handle("GET /api/users/me/2fa/totp/qr.png", middlewareIsAuthenticated(cfg, getTOTPQRCodeHandler(cfg)))
+	mux.Handle("POST /api/users/me/2fa/totp/verify", middlewareIsAuthenticated(cfg, verifyTOTPHandler(cfg)))
+
+	mux.Handle("POST /api/users/{userID}/follow", middlewareIsAuthenticated(cfg, followUserHandler(cfg)))
+	mux.Handle("DELETE /api/users/{userID}/follow", middlewareIsAuthenticated(cfg, unfollowUserHandler(cfg)))
+	mux.Handle("GET /api/users/{userID}/followers", getFollowersHandler(cfg))
+	mux.Handle("GET /api/users/{userID}/following", getFollowingHandler(cfg))
+
 	mux.Handle("POST /api/login", loginHandler(cfg))
+	mux.Handle("POST /api/login/2fa", loginTwoFactorHandler(cfg))
 	mux.Handle("POST /api/refresh", refreshHandler(cfg))
 	mux.Handle("POST /api/revoke", revokeHandler(cfg))
 
-	mux.Handle("POST /api/chirps", middlewareIsAuthenticated(cfg, createChirpHandler(cfg)))
-	mux.Handle("GET /api/chirps", getChirpsHandler(cfg))
-	mux.Handle("GET /api/chirps/{chirpID}", getChirpByIDHandler(cfg))
+	mux.Handle("POST /api/email/verify", verifyEmailHandler(cfg))
+	mux.Handle("POST /api/email/verify/resend", middlewareIsAuthenticated(cfg, resendEmailVerificationHandler(cfg)))
+
+	mux.Handle("POST /api/password/forgot", forgotPasswordHandler(cfg))
+	mux.Handle("POST /api/password/reset", resetPasswordHandler(cfg))
+
+	mux.Handle("GET /api/sessions", middlewareIsAuthenticated(cfg, getSessionsHandler(cfg)))
+	mux.Handle("DELETE /api/sessions", middlewareIsAuthenticated(cfg, revokeAllSessionsHandler(cfg)))
+	mux.Handle("DELETE /api/sessions/{sessionID}", middlewareIsAuthenticated(cfg, revokeSessionHandler(cfg)))
+
+	mux.Handle("POST /api/chirps", middlewareIsAuthenticated(cfg, middlewareIsVerified(cfg, createChirpHandler(cfg))))
+	mux.Handle("GET /api/chirps", middlewareOptionalAuthentication(cfg, getChirpsHandler(cfg)))
+	mux.Handle("GET /api/chirps/search", middlewareOptionalAuthentication(cfg, searchChirpsHandler(cfg)))
+	mux.Handle("GET /api/chirps/{chirpID}", middlewareOptionalAuthentication(cfg, getChirpByIDHandler(cfg)))
+	mux.Handle("PUT /api/chirps/{chirpID}", middlewareIsAuthenticated(cfg, middlewareIsVerified(cfg, updateChirpHandler(cfg))))
+	mux.Handle("GET /api/chirps/{chirpID}/revisions", getChirpRevisionsHandler(cfg))
+	mux.Handle("GET /api/chirps/{chirpID}/replies", middlewareOptionalAuthentication(cfg, getChirpRepliesHandler(cfg)))
+	mux.Handle("GET /api/chirps/{chirpID}/thread", middlewareOptionalAuthentication(cfg, getChirpThreadHandler(cfg)))
+	mux.Handle("POST /api/chirps/{chirpID}/like", middlewareIsAuthenticated(cfg, likeChirpHandler(cfg)))
+	mux.Handle("DELETE /api/chirps/{chirpID}/like", middlewareIsAuthenticated(cfg, unlikeChirpHandler(cfg)))
+	mux.Handle("POST /api/chirps/{chirpID}/rechirp", middlewareIsAuthenticated(cfg, middlewareIsVerified(cfg, createRechirpHandler(cfg))))
+	mux.Handle("DELETE /api/chirps/{chirpID}/rechirp", middlewareIsAuthenticated(cfg, deleteRechirpHandler(cfg)))
+	mux.Handle("POST /api/chirps/{chirpID}/quote", middlewareIsAuthenticated(cfg, middlewareIsVerified(cfg, createQuoteChirpHandler(cfg))))
 	mux.Handle("DELETE /api/chirps/{chirpID}", middlewareIsAuthenticated(cfg, deleteChirpByIDHandler(cfg)))
 
+	mux.Handle("GET /api/hashtags/trending", getTrendingHashtagsHandler(cfg))
+	mux.Handle("GET /api/hashtags/{tag}/chirps", middlewareOptionalAuthentication(cfg, getHashtagChirpsHandler(cfg)))
+
+	mux.Handle("GET /api/timeline", middlewareIsAuthenticated(cfg, getTimelineHandler(cfg)))
+
 	mux.Handle("POST /api/polka/webhooks", polkaWebhookHandler(cfg))
 
+	go expireChirpyRedPeriodically(cfg, CHIRPY_RED_EXPIRY_INTERVAL)
+	go cleanupLoginAttemptsPeriodically(cfg, LOGIN_ATTEMPTS_CLEAN_INTERVAL)
+
 	log.Printf("Server started at %s", server.Addr)
 	log.Fatal(server.ListenAndServe())
 }
+
+// loadKeyring reads JWT signing keys from a comma-separated list of
+// kid=path pairs. The first key signs new tokens, the others are retired keys
+// that are still accepted. Keys are required outside dev; there an ephemeral
+// one is generated instead, so tokens won't survive a restart.
+func loadKeyring(signingKeys, platform string) (*auth.Keyring, error) {
+	if strings.TrimSpace(signingKeys) == "" {
+		if platform != "dev" {
+			return nil, errors.New("JWT_SIGNING_KEYS is not set; AUTH_SECRET is no longer used, configure kid=path entries for PEM signing keys instead")
+		}
+		log.Printf("JWT_SIGNING_KEYS is not set, using an ephemeral signing key")
+		key, err := auth.GenerateSigningKey(uuid.NewString())
+		if err != nil {
+			return nil, err
+		}
+		return auth.NewKeyring(key)
+	}
+
+	var keys []auth.SigningKey
+	for _, entry := range strings.Split(signingKeys, ",") {
+		kid, path, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || kid == "" || path == "" {
+			return nil, fmt.Errorf("invalid signing key entry %q", entry)
+		}
+
+		pemBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := auth.ParseSigningKey(kid, pemBytes)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return auth.NewKeyring(keys[0], keys[1:]...)
+}
+
+// loadMailer only falls back to logging emails in development, since the logs
+// would otherwise hold every reset and verification link in plain text.
+func loadMailer(platform string) (mailer.Mailer, error) {
+	if os.Getenv("SMTP_HOST") == "" {
+		if platform != "dev" {
+			return nil, errors.New("SMTP_HOST is not set")
+		}
+		log.Printf("SMTP_HOST is not set, writing emails to the log")
+		return mailer.LogMailer{}, nil
+	}
+
+	return mailer.SMTPMailer{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+	}, nil
+}
+
+// loadPasswordHasher keeps the memory used by concurrent password hashes
+// within PASSWORD_HASH_MEMORY_MB (256 by default).
+func loadPasswordHasher() (auth.PasswordHasher, error) {
+	memoryMB := 256
+	if value := os.Getenv("PASSWORD_HASH_MEMORY_MB"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PASSWORD_HASH_MEMORY_MB: %w", err)
+		}
+		memoryMB = int(parsed)
+	}
+
+	hashMemory := auth.DefaultArgon2idParams.Memory
+	if memoryMB*1024 < int(hashMemory) || memoryMB*1024 > math.MaxUint32 {
+		return nil, fmt.Errorf("PASSWORD_HASH_MEMORY_MB must be between %d and %d", hashMemory/1024, math.MaxUint32/1024)
+	}
+	return auth.NewLimitedHasher(auth.DefaultPasswordHasher(), uint32(memoryMB*1024), hashMemory), nil
+}
+
+// loadPasswordPolicy starts from auth.DefaultPasswordPolicy and applies the
+// PASSWORD_MIN_LENGTH, PASSWORD_MIN_ENTROPY_BITS and BREACHED_PASSWORDS_DIR
+// overrides.
+func loadPasswordPolicy() (auth.PasswordPolicy, error) {
+	policy := auth.DefaultPasswordPolicy
+
+	if minLength := os.Getenv("PASSWORD_MIN_LENGTH"); minLength != "" {
+		value, err := strconv.Atoi(minLength)
+		if err != nil {
+			return auth.PasswordPolicy{}, fmt.Errorf("invalid PASSWORD_MIN_LENGTH: %w", err)
+		}
+		policy.MinLength = value
+	}
+
+	if minEntropy := os.Getenv("PASSWORD_MIN_ENTROPY_BITS"); minEntropy != "" {
+		value, err := strconv.ParseFloat(minEntropy, 64)
+		if err != nil {
+			return auth.PasswordPolicy{}, fmt.Errorf("invalid PASSWORD_MIN_ENTROPY_BITS: %w", err)
+		}
+		policy.MinEntropyBits = value
+	}
+
+	if breachedDir := os.Getenv("BREACHED_PASSWORDS_DIR"); breachedDir != "" {
+		info, err := os.Stat(breachedDir)
+		if err != nil {
+			return auth.PasswordPolicy{}, err
+		}
+		if !info.IsDir() {
+			return auth.PasswordPolicy{}, fmt.Errorf("BREACHED_PASSWORDS_DIR %s is not a directory", breachedDir)
+		}
+		policy.Breached = &auth.BreachedPasswordList{Dir: breachedDir}
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/thihxm/Chirpy/internal/config"
+	"github.com/thihxm/Chirpy/internal/database"
+	"github.com/thihxm/Chirpy/internal/utils"
+)
+
+type ChirpMention struct {
+	UserID uuid.UUID `json:"user_id"`
+	Start  int32     `json:"start"`
+	End    int32     `json:"end"`
+}
+
+// saveChirpMentions stores the @handles in the chirp body that belong to an
+// existing user. Unknown handles are left as plain text.
+func saveChirpMentions(r *http.Request, queries *database.Queries, chirp database.Chirp) error {
+	mentions := utils.ExtractMentions(chirp.Body)
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	handles := make([]string, len(mentions))
+	for i, mention := range mentions {
+		handles[i] = mention.Handle
+	}
+
+	users, err := queries.GetUsersByHandles(r.Context(), handles)
+	if err != nil {
+		return err
+	}
+
+	userIDsByHandle := make(map[string]uuid.UUID, len(users))
+	for _, user := range users {
+		userIDsByHandle[utils.NormalizeHandle(user.Handle.String)] = user.ID
+	}
+
+	params := database.CreateChirpMentionsParams{ChirpID: chirp.ID}
+	for _, mention := range mentions {
+		userID, ok := userIDsByHandle[mention.Handle]
+		if !ok {
+			continue
+		}
+		params.UserIds = append(params.UserIds, userID)
+		params.StartOffsets = append(params.StartOffsets, int32(mention.Start))
+		params.EndOffsets = append(params.EndOffsets, int32(mention.End))
+	}
+
+	if len(params.UserIds) == 0 {
+		return nil
+	}
+
+	return queries.CreateChirpMentions(r.Context(), params)
+}
+
+func withMentions(r *http.Request, cfg *config.ApiConfig, chirps []Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(chirps))
+	for i, chirp := range chirps {
+		ids[i] = chirp.ID
+	}
+
+	rows, err := cfg.Queries.GetChirpMentions(r.Context(), ids)
+	if err != nil {
+		return err
+	}
+
+	mentionsByChirpID := make(map[uuid.UUID][]ChirpMention, len(rows))
+	for _, row := range rows {
+		mentionsByChirpID[row.ChirpID] = append(mentionsByChirpID[row.ChirpID], ChirpMention{
+			UserID: row.UserID,
+			Start:  row.StartOffset,
+			End:    row.EndOffset,
+		})
+	}
+
+	for i := range chirps {
+		chirps[i].Mentions = mentionsByChirpID[chirps[i].ID]
+		if chirps[i].Mentions == nil {
+			chirps[i].Mentions = []ChirpMention{}
+		}
+	}
+
+	return nil
+}
+
+func getMyMentionsHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, err := parsePageParams(r)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+			return
+		}
+
+		userID := r.Context().Value(userIDKey).(uuid.UUID)
+
+		rawChirps, err := cfg.Queries.GetMentionChirps(r.Context(), database.GetMentionChirpsParams{
+			UserID:          userID,
+			CursorCreatedAt: page.CursorCreatedAt,
+			CursorID:        page.CursorID,
+			Limit:           page.fetchLimit(),
+		})
+		if err != nil {
+			log.Printf("Error getting mentions: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		chirpPage := newChirpPage(rawChirps, page.Limit)
+		err = hydrateChirps(r, cfg, chirpPage.Chirps)
+		if err != nil {
+			log.Printf("Error loading chirp details: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, chirpPage)
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/thihxm/Chirpy/internal/utils"
+)
+
+const (
+	DEFAULT_PAGE_LIMIT = 20
+	MAX_PAGE_LIMIT     = 100
+)
+
+type pageParams struct {
+	Limit           int
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+}
+
+func parsePageParams(r *http.Request) (pageParams, error) {
+	page := pageParams{Limit: DEFAULT_PAGE_LIMIT}
+
+	if rawLimit := r.URL.Query().Get("limit"); rawLimit != "" {
+		limit, err := strconv.Atoi(rawLimit)
+		if err != nil || limit < 1 {
+			return pageParams{}, errors.New("invalid limit parameter")
+		}
+		page.Limit = min(limit, MAX_PAGE_LIMIT)
+	}
+
+	if rawCursor := r.URL.Query().Get("cursor"); rawCursor != "" {
+		createdAt, id, err := utils.DecodeCursor(rawCursor)
+		if err != nil {
+			return pageParams{}, errors.New("invalid cursor parameter")
+		}
+		page.CursorCreatedAt = sql.NullTime{Time: createdAt, Valid: true}
+		page.CursorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	return page, nil
+}
+
+// fetchLimit asks the database for one row more than the page size so we can
+// tell whether there is a next page without a separate count query.
+func (p pageParams) fetchLimit() int32 {
+	return int32(p.Limit + 1)
+}
+
+// setNextPageLink points to the next page in a Link header, for endpoints
+// whose body was a bare array before they were paginated.
+func setNextPageLink(w http.ResponseWriter, r *http.Request, nextCursor *string) {
+	if nextCursor == nil {
+		return
+	}
+
+	query := r.URL.Query()
+	query.Set("cursor", *nextCursor)
+	next := *r.URL
+	next.RawQuery = query.Encode()
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+}
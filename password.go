@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/thihxm/Chirpy/internal/auth"
+	"github.com/thihxm/Chirpy/internal/config"
+	"github.com/thihxm/Chirpy/internal/database"
+	"github.com/thihxm/Chirpy/internal/mailer"
+	"github.com/thihxm/Chirpy/internal/utils"
+)
+
+const (
+	PASSWORD_RESET_TOKEN_EXPIRATION_TIME = 1 * time.Hour
+	MAIL_SEND_TIMEOUT                    = 30 * time.Second
+)
+
+var errInvalidResetToken = errors.New("invalid or expired reset token")
+
+// respondIfPasswordRejected checks a new password against the policy and
+// answers with every violation it finds.
+func respondIfPasswordRejected(w http.ResponseWriter, cfg *config.ApiConfig, password string) bool {
+	violations, err := cfg.PasswordPolicy.Validate(password)
+	if err != nil {
+		// The breached password list is a second line of defence, so it
+		// being unreadable shouldn't block sign ups.
+		log.Printf("Error checking breached passwords: %v", err)
+	}
+	if len(violations) == 0 {
+		return false
+	}
+
+	type response struct {
+		Error      string                   `json:"error"`
+		Violations []auth.PasswordViolation `json:"violations"`
+	}
+
+	utils.RespondWithJSON(w, http.StatusBadRequest, response{
+		Error:      "Password does not meet the requirements",
+		Violations: violations,
+	})
+	return true
+}
+
+// sendMailInBackground delivers an email without making the request wait, so
+// response times don't reveal whether an account exists.
+func sendMailInBackground(cfg *config.ApiConfig, msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), MAIL_SEND_TIMEOUT)
+		defer cancel()
+
+		err := cfg.Mailer.Send(ctx, msg)
+		if err != nil {
+			log.Printf("Error sending email: %v", err)
+		}
+	}()
+}
+
+func forgotPasswordHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type parameters struct {
+			Email string `json:"email"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			log.Printf("Error decoding parameters: %v", err)
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request")
+			return
+		}
+
+		// Unknown emails get the same response as known ones, so the endpoint
+		// can't be used to find out who has an account.
+		user, err := cfg.Queries.GetUserByEmail(r.Context(), params.Email)
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithJSON(w, http.StatusNoContent, nil)
+			return
+		}
+		if err != nil {
+			log.Printf("Error getting user: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		// Reset tokens have the same shape as refresh tokens and are likewise
+		// only stored as digests.
+		resetToken, err := auth.MakeRefreshToken()
+		if err != nil {
+			log.Printf("Error generating reset token: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		_, err = cfg.Queries.CreatePasswordResetToken(r.Context(), database.CreatePasswordResetTokenParams{
+			TokenHash: auth.HashRefreshToken(resetToken),
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(PASSWORD_RESET_TOKEN_EXPIRATION_TIME),
+		})
+		if err != nil {
+			log.Printf("Error creating reset token: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		resetURL := cfg.AppURL + "/app/reset-password?token=" + url.QueryEscape(resetToken)
+		sendMailInBackground(cfg, mailer.Message{
+			To:      user.Email,
+			Subject: "Reset your Chirpy password",
+			Body: fmt.Sprintf(
+				"Someone asked to reset the password for your Chirpy account.\n\n"+
+					"Use this link within %d minutes to choose a new one:\n%s\n\n"+
+					"If it wasn't you, you can ignore this email.\n",
+				int(PASSWORD_RESET_TOKEN_EXPIRATION_TIME.Minutes()), resetURL,
+			),
+		})
+
+		utils.RespondWithJSON(w, http.StatusNoContent, nil)
+	})
+}
+
+func resetPasswordHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type parameters struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			log.Printf("Error decoding parameters: %v", err)
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request")
+			return
+		}
+
+		if respondIfPasswordRejected(w, cfg, params.Password) {
+			return
+		}
+
+		hashedPassword, err := cfg.PasswordHasher.Hash(params.Password)
+		if err != nil {
+			log.Printf("Error hashing password: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		// The token is only burned if the password change and the logout
+		// that comes with it go through as well.
+		err = cfg.InTx(r.Context(), func(queries *database.Queries) error {
+			resetToken, err := queries.ConsumePasswordResetToken(r.Context(), auth.HashRefreshToken(params.Token))
+			if errors.Is(err, sql.ErrNoRows) {
+				return errInvalidResetToken
+			}
+			if err != nil {
+				return fmt.Errorf("consuming reset token: %w", err)
+			}
+
+			_, err = queries.UpdateUser(r.Context(), database.UpdateUserParams{
+				ID:             resetToken.UserID,
+				HashedPassword: sql.NullString{String: hashedPassword, Valid: true},
+			})
+			if err != nil {
+				return fmt.Errorf("updating password: %w", err)
+			}
+
+			// Whoever knew the old password may still be logged in, so every
+			// session and outstanding reset link is ended.
+			err = queries.InvalidatePasswordResetTokens(r.Context(), resetToken.UserID)
+			if err != nil {
+				return fmt.Errorf("invalidating reset tokens: %w", err)
+			}
+
+			err = queries.RevokeAllUserRefreshTokens(r.Context(), resetToken.UserID)
+			if err != nil {
+				return fmt.Errorf("revoking refresh tokens: %w", err)
+			}
+
+			err = queries.InvalidateUserTokens(r.Context(), database.InvalidateUserTokensParams{
+				ID:               resetToken.UserID,
+				TokensValidAfter: sql.NullTime{Time: auth.TokensValidAfter(time.Now()), Valid: true},
+			})
+			if err != nil {
+				return fmt.Errorf("invalidating access tokens: %w", err)
+			}
+			return nil
+		})
+		if errors.Is(err, errInvalidResetToken) {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid or expired reset token")
+			return
+		}
+		if err != nil {
+			log.Printf("Error resetting password: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusNoContent, nil)
+	})
+}
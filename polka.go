@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/thihxm/Chirpy/internal/auth"
@@ -15,50 +22,263 @@ import (
 type webhookEventTypes string
 
 const (
-	userUpgraded webhookEventTypes = "user.upgraded"
+	userUpgraded          webhookEventTypes = "user.upgraded"
+	userDowngraded        webhookEventTypes = "user.downgraded"
+	subscriptionCancelled webhookEventTypes = "subscription.cancelled"
+	paymentRefunded       webhookEventTypes = "payment.refunded"
 )
 
+const (
+	webhookStatusReceived   = "received"
+	webhookStatusProcessing = "processing"
+	webhookStatusProcessed  = "processed"
+	webhookStatusIgnored    = "ignored"
+	webhookStatusFailed     = "failed"
+)
+
+var (
+	errUnhandledWebhookEvent = errors.New("unhandled webhook event")
+	errWebhookUserNotFound   = errors.New("user not found")
+)
+
+const (
+	CHIRPY_RED_EXPIRY_INTERVAL = 1 * time.Minute
+
+	WEBHOOK_SIGNATURE_TOLERANCE = 5 * time.Minute
+	MAX_WEBHOOK_BODY_SIZE       = 1 << 20
+	// WEBHOOK_PROCESSING_LEASE is how long an event can stay in processing
+	// before it is assumed to be abandoned and can be claimed again.
+	WEBHOOK_PROCESSING_LEASE = 5 * time.Minute
+)
+
+// hasChirpyRed reports whether the user's paid period is still running. The
+// is_chirpy_red flag is only cleared by the expiry job, so it can lag behind.
+func hasChirpyRed(user database.User, now time.Time) bool {
+	if !user.IsChirpyRed {
+		return false
+	}
+	return !user.ChirpyRedExpiresAt.Valid || user.ChirpyRedExpiresAt.Time.After(now)
+}
+
+func expireChirpyRedPeriodically(cfg *config.ApiConfig, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		expired, err := cfg.Queries.ExpireChirpRed(context.Background())
+		if err != nil {
+			log.Printf("Error expiring Chirpy Red: %v", err)
+			continue
+		}
+		if expired > 0 {
+			log.Printf("Expired Chirpy Red for %d users", expired)
+		}
+	}
+}
+
+type polkaEvent struct {
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	Data  struct {
+		UserID      uuid.UUID  `json:"user_id"`
+		PeriodStart *time.Time `json:"period_start"`
+		PeriodEnd   *time.Time `json:"period_end"`
+	} `json:"data"`
+}
+
+// polkaEventID identifies a delivery so retries can be deduplicated. Polka
+// sends the ID in the payload or a header. Deliveries without one are keyed
+// on the signed timestamp as well as the body, since the same event for the
+// same user can legitimately happen more than once.
+func polkaEventID(r *http.Request, event polkaEvent, body []byte) string {
+	if event.ID != "" {
+		return event.ID
+	}
+	if headerID := r.Header.Get("X-Polka-Event-Id"); headerID != "" {
+		return headerID
+	}
+	digest := sha256.Sum256(body)
+	return "sha256:" + r.Header.Get(auth.WebhookTimestampHeader) + ":" + hex.EncodeToString(digest[:])
+}
+
 func polkaWebhookHandler(cfg *config.ApiConfig) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if apiKey, err := auth.GetAPIKey(r.Header); err != nil || apiKey != cfg.PolkaKey {
-			utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MAX_WEBHOOK_BODY_SIZE))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request")
 			return
 		}
 
-		type parameters struct {
-			Event string `json:"event"`
-			Data  struct {
-				UserID uuid.UUID `json:"user_id"`
-			} `json:"data"`
+		err = auth.VerifyWebhookSignature(r.Header, body, cfg.PolkaKeys, WEBHOOK_SIGNATURE_TOLERANCE, time.Now())
+		if err != nil {
+			log.Printf("Rejected Polka webhook: %v", err)
+			utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
 		}
 
-		decoder := json.NewDecoder(r.Body)
-		params := parameters{}
-		err := decoder.Decode(&params)
+		event := polkaEvent{}
+		err = json.Unmarshal(body, &event)
 		if err != nil {
 			log.Printf("Error decoding parameters: %v", err)
 			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request")
 			return
 		}
 
-		if params.Event != string(userUpgraded) {
+		eventID := polkaEventID(r, event, body)
+		webhookEvent, err := cfg.Queries.CreateWebhookEvent(r.Context(), database.CreateWebhookEventParams{
+			EventID: eventID,
+			Event:   event.Event,
+			Payload: body,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			webhookEvent, err = cfg.Queries.GetWebhookEventByEventID(r.Context(), eventID)
+		}
+		if err != nil {
+			log.Printf("Error recording webhook event: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		// Only new, previously failed or abandoned deliveries are processed,
+		// everything else is a retry of an event we already handled.
+		claimed, err := cfg.Queries.ClaimWebhookEvent(r.Context(), database.ClaimWebhookEventParams{
+			ID:           webhookEvent.ID,
+			Statuses:     []string{webhookStatusReceived, webhookStatusFailed},
+			LeaseSeconds: int32(WEBHOOK_PROCESSING_LEASE.Seconds()),
+		})
+		if errors.Is(err, sql.ErrNoRows) {
 			utils.RespondWithJSON(w, http.StatusNoContent, nil)
 			return
 		}
+		if err != nil {
+			log.Printf("Error claiming webhook event: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		err = runWebhookEvent(r.Context(), cfg, claimed)
+		if errors.Is(err, errWebhookUserNotFound) {
+			utils.RespondWithError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		if err != nil {
+			log.Printf("Error processing webhook event: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusNoContent, nil)
+	})
+}
+
+// runWebhookEvent processes a claimed event and records the outcome on it.
+func runWebhookEvent(ctx context.Context, cfg *config.ApiConfig, webhookEvent database.WebhookEvent) error {
+	err := processPolkaEvent(ctx, cfg, webhookEvent.Payload)
+
+	status := webhookStatusProcessed
+	var errorMessage sql.NullString
+	switch {
+	case errors.Is(err, errUnhandledWebhookEvent):
+		status = webhookStatusIgnored
+		err = nil
+	case err != nil:
+		status = webhookStatusFailed
+		errorMessage = sql.NullString{String: err.Error(), Valid: true}
+	}
 
-		_, err = cfg.Queries.UpgradeToChirpRed(
-			r.Context(),
+	finishErr := cfg.Queries.FinishWebhookEvent(ctx, database.FinishWebhookEventParams{
+		ID:     webhookEvent.ID,
+		Status: status,
+		Error:  errorMessage,
+	})
+	if finishErr != nil {
+		log.Printf("Error updating webhook event status: %v", finishErr)
+	}
+
+	return err
+}
+
+func processPolkaEvent(ctx context.Context, cfg *config.ApiConfig, payload []byte) error {
+	params := polkaEvent{}
+	err := json.Unmarshal(payload, &params)
+	if err != nil {
+		return err
+	}
+
+	event := webhookEventTypes(params.Event)
+	if event != userUpgraded && event != userDowngraded && event != subscriptionCancelled && event != paymentRefunded {
+		return errUnhandledWebhookEvent
+	}
+
+	user, err := cfg.Queries.GetUserByID(ctx, params.Data.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errWebhookUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	periodStart := now
+	if params.Data.PeriodStart != nil {
+		periodStart = *params.Data.PeriodStart
+	}
+
+	// Polka doesn't always say when the paid period ends. Without it an
+	// upgrade is open-ended and lasts until a downgrade, cancellation or
+	// refund.
+	var periodEnd sql.NullTime
+	if params.Data.PeriodEnd != nil {
+		periodEnd = sql.NullTime{Time: *params.Data.PeriodEnd, Valid: true}
+	}
+
+	var isChirpyRed bool
+	switch event {
+	case userUpgraded:
+		isChirpyRed = true
+	case subscriptionCancelled:
+		// A cancelled subscription stops renewing, but the user keeps Red
+		// until the period they already paid for is over.
+		if !periodEnd.Valid {
+			periodEnd = sql.NullTime{Time: now, Valid: true}
+			if user.ChirpyRedExpiresAt.Valid {
+				periodEnd.Time = user.ChirpyRedExpiresAt.Time
+			}
+		}
+		isChirpyRed = hasChirpyRed(user, now) && periodEnd.Time.After(now)
+	case userDowngraded, paymentRefunded:
+		isChirpyRed = false
+		periodEnd = sql.NullTime{Time: now, Valid: true}
+	}
+
+	if event != userUpgraded && params.Data.PeriodStart == nil {
+		latest, err := cfg.Queries.GetLatestChirpyRedSubscription(ctx, user.ID)
+		if err == nil {
+			periodStart = latest.PeriodStart
+		}
+	}
+
+	// The user's status and the subscription history are saved together so
+	// they can't disagree after a failure.
+	return cfg.InTx(ctx, func(queries *database.Queries) error {
+		_, err := queries.UpgradeToChirpRed(
+			ctx,
 			database.UpgradeToChirpRedParams{
-				ID:          params.Data.UserID,
-				IsChirpyRed: true,
+				ID:                 user.ID,
+				IsChirpyRed:        isChirpyRed,
+				ChirpyRedExpiresAt: periodEnd,
 			},
 		)
 		if err != nil {
-			log.Printf("Error upgrading user: %v", err)
-			utils.RespondWithError(w, http.StatusNotFound, "User not found")
-			return
+			return err
 		}
 
-		utils.RespondWithJSON(w, http.StatusNoContent, nil)
+		_, err = queries.CreateChirpyRedSubscription(ctx, database.CreateChirpyRedSubscriptionParams{
+			UserID:      user.ID,
+			Event:       string(event),
+			PeriodStart: periodStart,
+			PeriodEnd:   periodEnd,
+		})
+		return err
 	})
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thihxm/Chirpy/internal/config"
+	"github.com/thihxm/Chirpy/internal/utils"
+)
+
+type ChirpRevision struct {
+	ID        uuid.UUID `json:"id"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func getChirpRevisionsHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawID := r.PathValue("chirpID")
+
+		id, err := uuid.Parse(rawID)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+			return
+		}
+
+		chirp, err := cfg.Queries.GetChirpByID(r.Context(), id)
+		if err != nil || chirp.DeletedAt.Valid {
+			utils.RespondWithError(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+
+		rawRevisions, err := cfg.Queries.GetChirpRevisions(r.Context(), id)
+		if err != nil {
+			log.Printf("Error getting chirp revisions: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		revisions := make([]ChirpRevision, len(rawRevisions))
+		for i, revision := range rawRevisions {
+			revisions[i] = ChirpRevision(revision)
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, revisions)
+	})
+}
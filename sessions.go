@@ -0,0 +1,115 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thihxm/Chirpy/internal/auth"
+	"github.com/thihxm/Chirpy/internal/config"
+	"github.com/thihxm/Chirpy/internal/database"
+	"github.com/thihxm/Chirpy/internal/utils"
+)
+
+// Session is a login, identified by the refresh token family it started.
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func getSessionsHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value(userIDKey).(uuid.UUID)
+
+		rawSessions, err := cfg.Queries.GetActiveSessions(r.Context(), userID)
+		if err != nil {
+			log.Printf("Error getting sessions: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		sessions := make([]Session, 0, len(rawSessions))
+		for _, session := range rawSessions {
+			sessions = append(sessions, Session{
+				ID:         session.FamilyID,
+				UserAgent:  session.UserAgent,
+				IPAddress:  session.IpAddress,
+				CreatedAt:  session.StartedAt,
+				LastUsedAt: session.LastUsedAt,
+				ExpiresAt:  session.ExpiresAt,
+			})
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, sessions)
+	})
+}
+
+func revokeSessionHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid session ID")
+			return
+		}
+
+		userID := r.Context().Value(userIDKey).(uuid.UUID)
+
+		revoked, err := cfg.Queries.RevokeUserRefreshTokenFamily(r.Context(), database.RevokeUserRefreshTokenFamilyParams{
+			FamilyID: sessionID,
+			UserID:   userID,
+		})
+		if err != nil {
+			log.Printf("Error revoking session: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		if revoked == 0 {
+			utils.RespondWithError(w, http.StatusNotFound, "Session not found")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusNoContent, nil)
+	})
+}
+
+// revokeAllSessionsHandler logs the user out everywhere: every refresh token
+// is revoked and access tokens issued until now stop being accepted.
+func revokeAllSessionsHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value(userIDKey).(uuid.UUID)
+
+		err := cfg.Queries.RevokeAllUserRefreshTokens(r.Context(), userID)
+		if err != nil {
+			log.Printf("Error revoking refresh tokens: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		err = cfg.Queries.InvalidateUserTokens(r.Context(), database.InvalidateUserTokensParams{
+			ID:               userID,
+			TokensValidAfter: sql.NullTime{Time: auth.TokensValidAfter(time.Now()), Valid: true},
+		})
+		if err != nil {
+			log.Printf("Error invalidating access tokens: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusNoContent, nil)
+	})
+}
@@ -1,28 +1,76 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
+    $2,
+    $3
+)
+RETURNING *;
+
+
+-- name: CreateRechirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, rechirp_of)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    '',
+    $1,
     $2
 )
+ON CONFLICT (user_id, rechirp_of) WHERE rechirp_of IS NOT NULL DO NOTHING
 RETURNING *;
 
 
+-- name: CreateQuoteChirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, quote_of)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING *;
+
+
+-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1 AND rechirp_of = $2;
+
+
 -- name: ResetChirps :exec
 DELETE FROM chirps;
 
 
--- name: GetChirps :many
+-- name: GetChirpsAfter :many
 SELECT *
 FROM chirps
 WHERE (user_id = sqlc.narg('author_id') OR sqlc.narg('author_id') IS NULL)
-ORDER BY CASE 
-    WHEN sqlc.narg('sort') = 'desc' THEN created_at
-END DESC, CASE 
-    WHEN sqlc.narg('sort') = 'asc' OR sqlc.narg('sort') = '' THEN created_at
-END ASC;
+    AND deleted_at IS NULL
+    AND (
+        sqlc.narg('cursor_created_at')::timestamp IS NULL
+        OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+    )
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+
+-- name: GetChirpsBefore :many
+SELECT *
+FROM chirps
+WHERE (user_id = sqlc.narg('author_id') OR sqlc.narg('author_id') IS NULL)
+    AND deleted_at IS NULL
+    AND (
+        sqlc.narg('cursor_created_at')::timestamp IS NULL
+        OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+    )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
 
 
 -- name: GetChirpByID :one
@@ -31,6 +79,138 @@ FROM chirps
 WHERE id = $1;
 
 
+-- name: LockChirpByID :one
+SELECT id
+FROM chirps
+WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+FOR UPDATE;
+
+
+-- name: GetChirpsByIDs :many
+SELECT *
+FROM chirps
+WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
+
+-- name: UpdateChirpBody :one
+WITH revision AS (
+    INSERT INTO chirp_revisions (id, chirp_id, body, created_at)
+    SELECT gen_random_uuid(), chirps.id, chirps.body, NOW()
+    FROM chirps
+    WHERE chirps.id = sqlc.arg('id')
+        AND chirps.user_id = sqlc.arg('user_id')
+        AND chirps.deleted_at IS NULL
+        AND chirps.created_at > NOW() - sqlc.arg('edit_window_seconds')::int * INTERVAL '1 second'
+)
+UPDATE chirps
+SET body = sqlc.arg('body'),
+    updated_at = NOW()
+WHERE id = sqlc.arg('id')
+    AND user_id = sqlc.arg('user_id')
+    AND deleted_at IS NULL
+    AND created_at > NOW() - sqlc.arg('edit_window_seconds')::int * INTERVAL '1 second'
+RETURNING *;
+
+
 -- name: DeleteChirpByID :exec
 DELETE FROM chirps
 WHERE id = $1 AND user_id = $2;
+
+
+-- name: SearchChirps :many
+SELECT *
+FROM chirps
+WHERE search_vector @@ to_tsquery('english', sqlc.arg('query'))
+    AND deleted_at IS NULL
+    AND (user_id = sqlc.narg('author_id') OR sqlc.narg('author_id') IS NULL)
+ORDER BY ts_rank(search_vector, to_tsquery('english', sqlc.arg('query'))) DESC, created_at DESC, id DESC
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+
+-- name: GetTimeline :many
+SELECT chirps.*
+FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = sqlc.arg('user_id')
+    AND chirps.deleted_at IS NULL
+    AND (
+        sqlc.narg('cursor_created_at')::timestamp IS NULL
+        OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+    )
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
+
+
+
+-- name: GetChirpReplies :many
+SELECT *
+FROM chirps
+WHERE in_reply_to = sqlc.arg('chirp_id')
+    AND (
+        sqlc.narg('cursor_created_at')::timestamp IS NULL
+        OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+    )
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+
+-- name: HasChirpReplies :one
+SELECT EXISTS (
+    SELECT 1
+    FROM chirps
+    WHERE in_reply_to = $1
+);
+
+
+-- name: TombstoneChirpByID :exec
+WITH deleted_revisions AS (
+    DELETE FROM chirp_revisions
+    USING chirps
+    WHERE chirp_revisions.chirp_id = chirps.id
+        AND chirps.id = $1
+        AND chirps.user_id = $2
+)
+UPDATE chirps
+SET body = '',
+    deleted_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1 AND user_id = $2;
+
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.created_at, parent.updated_at, parent.body, parent.user_id,
+        parent.in_reply_to, parent.deleted_at, parent.rechirp_of, parent.quote_of, 1 AS depth
+    FROM chirps AS child
+    JOIN chirps AS parent ON parent.id = child.in_reply_to
+    WHERE child.id = sqlc.arg('chirp_id')
+    UNION ALL
+    SELECT parent.id, parent.created_at, parent.updated_at, parent.body, parent.user_id,
+        parent.in_reply_to, parent.deleted_at, parent.rechirp_of, parent.quote_of, ancestors.depth + 1
+    FROM chirps AS parent
+    JOIN ancestors ON parent.id = ancestors.in_reply_to
+    WHERE ancestors.depth < sqlc.arg('max_depth')::int
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, rechirp_of, quote_of
+FROM ancestors
+ORDER BY depth DESC;
+
+
+-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, rechirp_of, quote_of,
+        1 AS depth
+    FROM chirps
+    WHERE in_reply_to = sqlc.arg('chirp_id')
+    UNION ALL
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id,
+        chirps.in_reply_to, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of, descendants.depth + 1
+    FROM chirps
+    JOIN descendants ON chirps.in_reply_to = descendants.id
+    WHERE descendants.depth < sqlc.arg('max_depth')::int
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, rechirp_of, quote_of
+FROM descendants
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
\ No newline at end of file
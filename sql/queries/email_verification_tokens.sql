@@ -0,0 +1,20 @@
+-- name: CreateEmailVerificationToken :one
+INSERT INTO email_verification_tokens (token_hash, user_id, email, created_at, expires_at, used_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW(),
+    $4,
+    NULL
+)
+RETURNING *;
+
+
+-- name: ConsumeEmailVerificationToken :one
+UPDATE email_verification_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+    AND expires_at > NOW()
+    AND used_at IS NULL
+RETURNING *;
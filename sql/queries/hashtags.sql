@@ -0,0 +1,33 @@
+-- name: CreateChirpHashtags :exec
+INSERT INTO chirp_hashtags (chirp_id, tag, created_at)
+SELECT sqlc.arg('chirp_id')::uuid, tag, NOW()
+FROM unnest(sqlc.arg('tags')::text[]) AS tag
+ON CONFLICT (chirp_id, tag) DO NOTHING;
+
+
+-- name: DeleteChirpHashtags :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id = $1;
+
+
+-- name: GetHashtagChirps :many
+SELECT chirps.*
+FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+WHERE chirp_hashtags.tag = sqlc.arg('tag')
+    AND chirps.deleted_at IS NULL
+    AND (
+        sqlc.narg('cursor_created_at')::timestamp IS NULL
+        OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+    )
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
+
+
+-- name: GetTrendingHashtags :many
+SELECT tag, COUNT(*) AS uses
+FROM chirp_hashtags
+WHERE created_at > sqlc.arg('since')
+GROUP BY tag
+ORDER BY uses DESC, tag ASC
+LIMIT sqlc.arg('limit');
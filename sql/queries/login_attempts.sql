@@ -0,0 +1,42 @@
+-- name: RecordLoginAttempt :one
+INSERT INTO login_attempts (key, attempts, last_attempt_at, locked_until)
+VALUES (
+    sqlc.arg('key'),
+    1,
+    NOW(),
+    NULL
+)
+ON CONFLICT (key) DO UPDATE
+SET attempts = CASE
+        WHEN login_attempts.locked_until > NOW() THEN login_attempts.attempts
+        WHEN login_attempts.last_attempt_at < sqlc.arg('window_start') THEN 1
+        ELSE login_attempts.attempts + 1
+    END,
+    last_attempt_at = CASE
+        WHEN login_attempts.locked_until > NOW() THEN login_attempts.last_attempt_at
+        ELSE NOW()
+    END
+RETURNING attempts, locked_until;
+
+
+-- name: LockLogin :exec
+UPDATE login_attempts
+SET locked_until = $2
+WHERE key = $1;
+
+
+-- name: ForgiveLoginAttempt :exec
+UPDATE login_attempts
+SET attempts = GREATEST(attempts - 1, 0)
+WHERE key = $1;
+
+
+-- name: ClearLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE key = $1;
+
+
+-- name: DeleteStaleLoginAttempts :execrows
+DELETE FROM login_attempts
+WHERE last_attempt_at < $1
+    AND (locked_until IS NULL OR locked_until < NOW());
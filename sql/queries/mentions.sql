@@ -0,0 +1,39 @@
+-- name: CreateChirpMentions :exec
+INSERT INTO chirp_mentions (chirp_id, user_id, start_offset, end_offset, created_at)
+SELECT sqlc.arg('chirp_id')::uuid, mention.user_id, mention.start_offset, mention.end_offset, NOW()
+FROM unnest(
+    sqlc.arg('user_ids')::uuid[],
+    sqlc.arg('start_offsets')::int[],
+    sqlc.arg('end_offsets')::int[]
+) AS mention(user_id, start_offset, end_offset)
+ON CONFLICT (chirp_id, start_offset) DO NOTHING;
+
+
+-- name: DeleteChirpMentions :exec
+DELETE FROM chirp_mentions
+WHERE chirp_id = $1;
+
+
+-- name: GetChirpMentions :many
+SELECT chirp_id, user_id, start_offset, end_offset
+FROM chirp_mentions
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+ORDER BY chirp_id, start_offset;
+
+
+-- name: GetMentionChirps :many
+SELECT chirps.*
+FROM chirps
+WHERE chirps.deleted_at IS NULL
+    AND EXISTS (
+        SELECT 1
+        FROM chirp_mentions
+        WHERE chirp_mentions.chirp_id = chirps.id
+            AND chirp_mentions.user_id = sqlc.arg('user_id')
+    )
+    AND (
+        sqlc.narg('cursor_created_at')::timestamp IS NULL
+        OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+    )
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
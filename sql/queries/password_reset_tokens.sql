@@ -0,0 +1,26 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (token_hash, user_id, created_at, expires_at, used_at)
+VALUES (
+    $1,
+    $2,
+    NOW(),
+    $3,
+    NULL
+)
+RETURNING *;
+
+
+-- name: ConsumePasswordResetToken :one
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+    AND expires_at > NOW()
+    AND used_at IS NULL
+RETURNING *;
+
+
+-- name: InvalidatePasswordResetTokens :exec
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE user_id = $1
+    AND used_at IS NULL;
@@ -1,12 +1,16 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip_address, last_used_at)
 VALUES (
     $1,
     NOW(),
     NOW(),
     $2,
     $3,
-    NULL
+    NULL,
+    $4,
+    $5,
+    $6,
+    NOW()
 )
 RETURNING *;
 
@@ -14,7 +18,7 @@ RETURNING *;
 -- name: GetRefreshTokenByToken :one
 SELECT *
 FROM refresh_tokens
-WHERE token = $1
+WHERE token_hash = $1
     AND expires_at > NOW()
     AND revoked_at IS NULL;
 
@@ -23,6 +27,66 @@ WHERE token = $1
 UPDATE refresh_tokens
 SET revoked_at = NOW(),
     updated_at = NOW()
-WHERE token = $1
+WHERE token_hash = $1
     AND revoked_at IS NULL
-RETURNING *;
\ No newline at end of file
+RETURNING *;
+
+
+-- name: ConsumeRefreshToken :one
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+    updated_at = NOW(),
+    last_used_at = NOW()
+WHERE token_hash = $1
+    AND expires_at > NOW()
+    AND revoked_at IS NULL
+RETURNING *;
+
+
+-- name: FindRefreshToken :one
+SELECT *
+FROM refresh_tokens
+WHERE token_hash = $1;
+
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+    updated_at = NOW()
+WHERE family_id = $1
+    AND revoked_at IS NULL;
+
+
+-- name: GetActiveSessions :many
+SELECT current.family_id,
+    current.user_agent,
+    current.ip_address,
+    current.last_used_at,
+    current.expires_at,
+    (
+        SELECT MIN(first.created_at)
+        FROM refresh_tokens first
+        WHERE first.family_id = current.family_id
+    )::TIMESTAMP AS started_at
+FROM refresh_tokens current
+WHERE current.user_id = $1
+    AND current.expires_at > NOW()
+    AND current.revoked_at IS NULL
+ORDER BY current.last_used_at DESC;
+
+
+-- name: RevokeUserRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+    updated_at = NOW()
+WHERE family_id = $1
+    AND user_id = $2
+    AND revoked_at IS NULL;
+
+
+-- name: RevokeAllUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+    updated_at = NOW()
+WHERE user_id = $1
+    AND revoked_at IS NULL;
@@ -0,0 +1,19 @@
+-- name: CreateChirpyRedSubscription :one
+INSERT INTO chirpy_red_subscriptions (id, user_id, event, period_start, period_end, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+)
+RETURNING *;
+
+
+-- name: GetLatestChirpyRedSubscription :one
+SELECT *
+FROM chirpy_red_subscriptions
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT 1;
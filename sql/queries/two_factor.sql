@@ -0,0 +1,43 @@
+-- name: SetPendingTOTPSecret :execrows
+UPDATE users
+SET totp_secret = $2,
+    totp_last_used_step = NULL,
+    updated_at = NOW()
+WHERE id = $1
+    AND totp_enabled_at IS NULL;
+
+
+-- name: EnableTOTP :execrows
+UPDATE users
+SET totp_enabled_at = NOW(),
+    totp_last_used_step = $2,
+    updated_at = NOW()
+WHERE id = $1
+    AND totp_secret IS NOT NULL
+    AND totp_enabled_at IS NULL;
+
+
+-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_used_step = $2
+WHERE id = $1
+    AND (totp_last_used_step IS NULL OR totp_last_used_step < $2);
+
+
+-- name: CreateRecoveryCodes :exec
+INSERT INTO recovery_codes (id, user_id, code_hash, created_at, used_at)
+SELECT gen_random_uuid(), sqlc.arg('user_id')::uuid, code_hash, NOW(), NULL
+FROM unnest(sqlc.arg('code_hashes')::text[]) AS code_hash;
+
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
+
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1
+    AND code_hash = $2
+    AND used_at IS NULL;
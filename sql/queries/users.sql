@@ -22,16 +22,87 @@ WHERE email = $1;
 
 -- name: UpdateUser :one
 UPDATE users
-SET email = $1,
-    hashed_password = $2,
+SET email = COALESCE(sqlc.narg('email'), email),
+    hashed_password = COALESCE(sqlc.narg('hashed_password'), hashed_password),
+    handle = COALESCE(sqlc.narg('handle'), handle),
+    display_name = COALESCE(sqlc.narg('display_name'), display_name),
+    bio = COALESCE(sqlc.narg('bio'), bio),
     updated_at = NOW()
-WHERE id = $3
+WHERE id = sqlc.arg('id')
 RETURNING *;
 
 
+-- name: RehashUserPassword :exec
+UPDATE users
+SET hashed_password = sqlc.arg('new_hashed_password')
+WHERE id = sqlc.arg('id')
+    AND hashed_password = sqlc.arg('old_hashed_password');
+
+
 -- name: UpgradeToChirpRed :one
 UPDATE users
 SET is_chirpy_red = $1,
+    chirpy_red_expires_at = $2,
+    updated_at = NOW()
+WHERE id = $3
+RETURNING *;
+
+
+-- name: ExpireChirpRed :execrows
+UPDATE users
+SET is_chirpy_red = false,
+    updated_at = NOW()
+WHERE is_chirpy_red = true
+    AND chirpy_red_expires_at IS NOT NULL
+    AND chirpy_red_expires_at <= NOW();
+
+
+-- name: GetUserByID :one
+SELECT *
+FROM users
+WHERE id = $1;
+
+
+-- name: GetUsersByHandles :many
+SELECT id, handle
+FROM users
+WHERE LOWER(handle) = ANY(sqlc.arg('handles')::text[]);
+
+
+
+-- name: GetUserByHandle :one
+SELECT *
+FROM users
+WHERE LOWER(handle) = LOWER(sqlc.arg('handle'));
+
+
+-- name: GetUserTokensValidAfter :one
+SELECT tokens_valid_after
+FROM users
+WHERE id = $1;
+
+
+-- name: InvalidateUserTokens :exec
+UPDATE users
+SET tokens_valid_after = $2,
+    updated_at = NOW()
+WHERE id = $1;
+
+
+-- name: SetPendingEmail :one
+UPDATE users
+SET pending_email = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+
+-- name: VerifyUserEmail :one
+UPDATE users
+SET email = sqlc.arg('email'),
+    email_verified_at = NOW(),
+    pending_email = CASE WHEN pending_email = sqlc.arg('email') THEN NULL ELSE pending_email END,
     updated_at = NOW()
-WHERE id = $2
+WHERE id = sqlc.arg('id')
+    AND (email = sqlc.arg('email') OR pending_email = sqlc.arg('email'))
 RETURNING *;
@@ -0,0 +1,62 @@
+-- name: CreateWebhookEvent :one
+INSERT INTO webhook_events (id, event_id, event, payload, status, error, attempts, created_at, updated_at, processed_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    'received',
+    NULL,
+    0,
+    NOW(),
+    NOW(),
+    NULL
+)
+ON CONFLICT (event_id) DO NOTHING
+RETURNING *;
+
+
+-- name: GetWebhookEventByEventID :one
+SELECT *
+FROM webhook_events
+WHERE event_id = $1;
+
+
+-- name: GetWebhookEventByID :one
+SELECT *
+FROM webhook_events
+WHERE id = $1;
+
+
+-- name: ClaimWebhookEvent :one
+UPDATE webhook_events
+SET status = 'processing',
+    attempts = attempts + 1,
+    updated_at = NOW()
+WHERE id = sqlc.arg('id')
+    AND (
+        status = ANY(sqlc.arg('statuses')::text[])
+        OR (status = 'processing' AND updated_at < NOW() - sqlc.arg('lease_seconds')::int * INTERVAL '1 second')
+    )
+RETURNING *;
+
+
+-- name: FinishWebhookEvent :exec
+UPDATE webhook_events
+SET status = $2,
+    error = $3,
+    updated_at = NOW(),
+    processed_at = NOW()
+WHERE id = $1;
+
+
+-- name: ListWebhookEvents :many
+SELECT *
+FROM webhook_events
+WHERE (status = sqlc.narg('status') OR sqlc.narg('status') IS NULL)
+    AND (
+        sqlc.narg('cursor_created_at')::timestamp IS NULL
+        OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+    )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,29 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN rechirp_of UUID
+REFERENCES chirps(id)
+ON DELETE CASCADE;
+
+ALTER TABLE chirps
+ADD COLUMN quote_of UUID
+REFERENCES chirps(id)
+ON DELETE SET NULL;
+
+ALTER TABLE chirps
+ADD CONSTRAINT chirps_rechirp_or_quote_check
+CHECK (rechirp_of IS NULL OR quote_of IS NULL);
+
+CREATE UNIQUE INDEX chirps_user_id_rechirp_of_idx ON chirps (user_id, rechirp_of)
+WHERE rechirp_of IS NOT NULL;
+
+-- +goose Down
+DROP INDEX chirps_user_id_rechirp_of_idx;
+
+ALTER TABLE chirps
+DROP CONSTRAINT chirps_rechirp_or_quote_check;
+
+ALTER TABLE chirps
+DROP COLUMN quote_of;
+
+ALTER TABLE chirps
+DROP COLUMN rechirp_of;
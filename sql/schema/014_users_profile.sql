@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN handle TEXT;
+
+CREATE UNIQUE INDEX users_handle_lower_idx ON users (LOWER(handle));
+
+ALTER TABLE users
+ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE users
+ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN bio;
+
+ALTER TABLE users
+DROP COLUMN display_name;
+
+DROP INDEX users_handle_lower_idx;
+
+ALTER TABLE users
+DROP COLUMN handle;
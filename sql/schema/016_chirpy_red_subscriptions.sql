@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN chirpy_red_expires_at TIMESTAMPTZ;
+
+CREATE TABLE chirpy_red_subscriptions(
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    event TEXT NOT NULL,
+    period_start TIMESTAMPTZ NOT NULL,
+    period_end TIMESTAMPTZ,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+);
+
+CREATE INDEX chirpy_red_subscriptions_user_id_created_at_idx ON chirpy_red_subscriptions (user_id, created_at);
+
+-- +goose Down
+DROP TABLE chirpy_red_subscriptions;
+
+ALTER TABLE users
+DROP COLUMN chirpy_red_expires_at;
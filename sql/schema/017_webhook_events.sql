@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE webhook_events(
+    id UUID PRIMARY KEY,
+    event_id TEXT NOT NULL UNIQUE,
+    event TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL,
+    error TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    processed_at TIMESTAMP
+);
+
+CREATE INDEX webhook_events_created_at_id_idx ON webhook_events (created_at, id);
+CREATE INDEX webhook_events_status_created_at_id_idx ON webhook_events (status, created_at, id);
+
+-- +goose Down
+DROP TABLE webhook_events;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+RENAME COLUMN token TO token_hash;
+
+-- Re-key existing sessions so they keep working: clients still hold the raw
+-- token and the server now hashes it before every lookup.
+UPDATE refresh_tokens
+SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
+
+-- +goose Down
+-- Hashes can't be turned back into tokens, so every session is dropped.
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO token;
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE login_attempts(
+    key TEXT PRIMARY KEY,
+    attempts INTEGER NOT NULL,
+    last_attempt_at TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ
+);
+
+CREATE INDEX login_attempts_last_attempt_at_idx ON login_attempts (last_attempt_at);
+
+-- +goose Down
+DROP TABLE login_attempts;
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thihxm/Chirpy/internal/auth"
+	"github.com/thihxm/Chirpy/internal/config"
+	"github.com/thihxm/Chirpy/internal/database"
+	"github.com/thihxm/Chirpy/internal/utils"
+)
+
+const (
+	TWO_FACTOR_CHALLENGE_EXPIRATION_TIME = 5 * time.Minute
+	TOTP_QR_CODE_SIZE                    = 256
+)
+
+var errTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// getPendingTOTPUser returns the authenticated user if they have started
+// enrolling in TOTP but haven't confirmed a code yet.
+func getPendingTOTPUser(w http.ResponseWriter, r *http.Request, cfg *config.ApiConfig) (database.User, bool) {
+	userID := r.Context().Value(userIDKey).(uuid.UUID)
+
+	user, err := cfg.Queries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+		return database.User{}, false
+	}
+
+	if user.TotpEnabledAt.Valid {
+		utils.RespondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return database.User{}, false
+	}
+
+	if !user.TotpSecret.Valid {
+		utils.RespondWithError(w, http.StatusNotFound, "Two-factor enrollment not found")
+		return database.User{}, false
+	}
+
+	return user, true
+}
+
+func enrollTOTPHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value(userIDKey).(uuid.UUID)
+
+		user, err := cfg.Queries.GetUserByID(r.Context(), userID)
+		if err != nil {
+			log.Printf("Error getting user: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		key, err := auth.GenerateTOTPKey(user.Email)
+		if err != nil {
+			log.Printf("Error generating TOTP key: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		// Enrolling again before verifying replaces the pending secret, but an
+		// enabled secret is never overwritten.
+		updated, err := cfg.Queries.SetPendingTOTPSecret(r.Context(), database.SetPendingTOTPSecretParams{
+			ID:         user.ID,
+			TotpSecret: sql.NullString{String: key.Secret, Valid: true},
+		})
+		if err != nil {
+			log.Printf("Error saving TOTP secret: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		if updated == 0 {
+			utils.RespondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusCreated, TOTPEnrollment{
+			Secret:          key.Secret,
+			ProvisioningURI: key.ProvisioningURI,
+		})
+	})
+}
+
+func getTOTPQRCodeHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := getPendingTOTPUser(w, r, cfg)
+		if !ok {
+			return
+		}
+
+		provisioningURI, err := auth.TOTPProvisioningURI(user.TotpSecret.String, user.Email)
+		if err != nil {
+			log.Printf("Error building provisioning URI: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		qrCode, err := auth.TOTPQRCode(provisioningURI, TOTP_QR_CODE_SIZE)
+		if err != nil {
+			log.Printf("Error rendering QR code: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		w.Write(qrCode)
+	})
+}
+
+func verifyTOTPHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type parameters struct {
+			Code string `json:"code"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			log.Printf("Error decoding parameters: %v", err)
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request")
+			return
+		}
+
+		user, ok := getPendingTOTPUser(w, r, cfg)
+		if !ok {
+			return
+		}
+
+		step, valid := auth.ValidateTOTPCode(user.TotpSecret.String, params.Code, time.Now())
+		if !valid {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Invalid code")
+			return
+		}
+
+		recoveryCodes, err := auth.GenerateRecoveryCodes(auth.RecoveryCodeCount)
+		if err != nil {
+			log.Printf("Error generating recovery codes: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		codeHashes := make([]string, 0, len(recoveryCodes))
+		for _, code := range recoveryCodes {
+			codeHashes = append(codeHashes, auth.HashRecoveryCode(code))
+		}
+
+		// Enabling 2FA locks the user row first, so a concurrent verify waits
+		// here and then finds it already enabled instead of replacing the codes
+		// this call hands out.
+		err = cfg.InTx(r.Context(), func(queries *database.Queries) error {
+			enabled, err := queries.EnableTOTP(r.Context(), database.EnableTOTPParams{
+				ID:               user.ID,
+				TotpLastUsedStep: sql.NullInt64{Int64: step, Valid: true},
+			})
+			if err != nil {
+				return fmt.Errorf("enabling TOTP: %w", err)
+			}
+			if enabled == 0 {
+				return errTOTPAlreadyEnabled
+			}
+
+			err = queries.DeleteRecoveryCodes(r.Context(), user.ID)
+			if err != nil {
+				return fmt.Errorf("deleting recovery codes: %w", err)
+			}
+
+			err = queries.CreateRecoveryCodes(r.Context(), database.CreateRecoveryCodesParams{
+				UserID:     user.ID,
+				CodeHashes: codeHashes,
+			})
+			if err != nil {
+				return fmt.Errorf("saving recovery codes: %w", err)
+			}
+			return nil
+		})
+		if errors.Is(err, errTOTPAlreadyEnabled) {
+			utils.RespondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+			return
+		}
+		if err != nil {
+			log.Printf("Error enabling two-factor authentication: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		type response struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, response{
+			RecoveryCodes: recoveryCodes,
+		})
+	})
+}
+
+// loginTwoFactorHandler trades a login challenge token and a TOTP or
+// recovery code for a session.
+func loginTwoFactorHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type parameters struct {
+			ChallengeToken string `json:"challenge_token"`
+			Code           string `json:"code"`
+			RecoveryCode   string `json:"recovery_code"`
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			log.Printf("Error decoding parameters: %v", err)
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request")
+			return
+		}
+
+		userID, err := auth.ValidateChallengeToken(params.ChallengeToken, cfg.Keyring)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		user, err := cfg.Queries.GetUserByID(r.Context(), userID)
+		if err != nil {
+			log.Printf("Error getting user: %v", err)
+			utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		if !user.TotpEnabledAt.Valid || !user.TotpSecret.Valid {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		// Codes are short enough to guess, so they count towards the same
+		// limits as passwords.
+		attemptKeys := loginAttemptKeys(r, user.Email)
+		if respondIfLoginLocked(w, r, cfg, attemptKeys) {
+			return
+		}
+
+		var used int64
+		switch {
+		case params.Code != "":
+			step, valid := auth.ValidateTOTPCode(user.TotpSecret.String, params.Code, time.Now())
+			if !valid {
+				utils.RespondWithError(w, http.StatusUnauthorized, "Invalid code")
+				return
+			}
+
+			// Each time step is only accepted once, so an observed code can't
+			// be replayed while it is still valid.
+			used, err = cfg.Queries.UseTOTPStep(r.Context(), database.UseTOTPStepParams{
+				ID:               user.ID,
+				TotpLastUsedStep: sql.NullInt64{Int64: step, Valid: true},
+			})
+		case params.RecoveryCode != "":
+			used, err = cfg.Queries.UseRecoveryCode(r.Context(), database.UseRecoveryCodeParams{
+				UserID:   user.ID,
+				CodeHash: auth.HashRecoveryCode(params.RecoveryCode),
+			})
+		default:
+			utils.RespondWithError(w, http.StatusBadRequest, "A code or recovery code is required")
+			return
+		}
+		if err != nil {
+			log.Printf("Error checking second factor: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		if used == 0 {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Invalid code")
+			return
+		}
+
+		clearLoginFailures(r.Context(), cfg, attemptKeys)
+		respondWithSession(w, r, cfg, user, DEFAULT_TOKEN_EXPIRATION_TIME)
+	})
+}
@@ -1,26 +1,76 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/thihxm/Chirpy/internal/auth"
+	"github.com/lib/pq"
 	"github.com/thihxm/Chirpy/internal/config"
 	"github.com/thihxm/Chirpy/internal/database"
 	"github.com/thihxm/Chirpy/internal/utils"
 )
 
 type User struct {
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	PendingEmail  *string   `json:"pending_email"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	Handle        *string   `json:"handle"`
+	DisplayName   string    `json:"display_name"`
+	Bio           string    `json:"bio"`
+}
+
+func newUser(user database.User) User {
+	return User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail:  nullStringPtr(user.PendingEmail),
+		IsChirpyRed:   user.IsChirpyRed,
+		Handle:        nullStringPtr(user.Handle),
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+	}
+}
+
+// PublicProfile is what anyone can see about a user. It must never include
+// the email address.
+type PublicProfile struct {
 	ID          uuid.UUID `json:"id"`
 	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
+	Handle      *string   `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
 	IsChirpyRed bool      `json:"is_chirpy_red"`
 }
 
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
+func isForeignKeyViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503" && pqErr.Constraint == constraint
+}
+
 func createUserHandler(cfg *config.ApiConfig) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		type parameters struct {
@@ -36,7 +86,17 @@ func createUserHandler(cfg *config.ApiConfig) http.Handler {
 			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request")
 			return
 		}
-		hashedPassword, err := auth.HashPassword(params.Password)
+
+		if err := utils.ValidateEmail(params.Email); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid email address")
+			return
+		}
+
+		if respondIfPasswordRejected(w, cfg, params.Password) {
+			return
+		}
+
+		hashedPassword, err := cfg.PasswordHasher.Hash(params.Password)
 		if err != nil {
 			log.Printf("Error hashing password: %v", err)
 			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
@@ -53,21 +113,23 @@ func createUserHandler(cfg *config.ApiConfig) http.Handler {
 			return
 		}
 
-		utils.RespondWithJSON(w, http.StatusCreated, User{
-			ID:          user.ID,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		})
+		err = sendEmailVerification(r, cfg, user.ID, user.Email)
+		if err != nil {
+			log.Printf("Error sending email verification: %v", err)
+		}
+
+		utils.RespondWithJSON(w, http.StatusCreated, newUser(user))
 	})
 }
 
 func updateUserHandler(cfg *config.ApiConfig) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		type parameters struct {
-			Email    string `json:"email"`
-			Password string `json:"password"`
+			Email       *string `json:"email"`
+			Password    *string `json:"password"`
+			Handle      *string `json:"handle"`
+			DisplayName *string `json:"display_name"`
+			Bio         *string `json:"bio"`
 		}
 
 		decoder := json.NewDecoder(r.Body)
@@ -80,32 +142,144 @@ func updateUserHandler(cfg *config.ApiConfig) http.Handler {
 		}
 
 		userID := r.Context().Value(userIDKey).(uuid.UUID)
-		hashedPassword, err := auth.HashPassword(params.Password)
+		updateParams := database.UpdateUserParams{ID: userID}
+
+		if params.Email != nil {
+			if err := utils.ValidateEmail(*params.Email); err != nil {
+				utils.RespondWithError(w, http.StatusBadRequest, "Invalid email address")
+				return
+			}
+		}
+
+		if params.Password != nil {
+			if respondIfPasswordRejected(w, cfg, *params.Password) {
+				return
+			}
+
+			hashedPassword, err := cfg.PasswordHasher.Hash(*params.Password)
+			if err != nil {
+				log.Printf("Error hashing password: %v", err)
+				utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+				return
+			}
+			updateParams.HashedPassword = sql.NullString{String: hashedPassword, Valid: true}
+		}
+
+		if params.Handle != nil {
+			err = utils.ValidateHandle(*params.Handle)
+			if errors.Is(err, utils.ErrReservedHandle) {
+				utils.RespondWithError(w, http.StatusBadRequest, "Handle is not available")
+				return
+			}
+			if err != nil {
+				utils.RespondWithError(w, http.StatusBadRequest, "Invalid handle")
+				return
+			}
+			updateParams.Handle = sql.NullString{String: *params.Handle, Valid: true}
+		}
+
+		if params.DisplayName != nil {
+			if err := utils.ValidateDisplayName(*params.DisplayName); err != nil {
+				utils.RespondWithError(w, http.StatusBadRequest, "Display name is too long")
+				return
+			}
+			updateParams.DisplayName = sql.NullString{String: *params.DisplayName, Valid: true}
+		}
+
+		if params.Bio != nil {
+			if err := utils.ValidateBio(*params.Bio); err != nil {
+				utils.RespondWithError(w, http.StatusBadRequest, "Bio is too long")
+				return
+			}
+			updateParams.Bio = sql.NullString{String: *params.Bio, Valid: true}
+		}
+
+		// The profile and a pending email change are saved together, so a
+		// failure part way through can't leave only some of them applied.
+		var user database.User
+		var emailChanged, emailTaken bool
+		err = cfg.InTx(r.Context(), func(queries *database.Queries) error {
+			var err error
+			user, err = queries.UpdateUser(r.Context(), updateParams)
+			if err != nil {
+				return err
+			}
+
+			// A new email only replaces the current one once it's confirmed.
+			if params.Email == nil || *params.Email == user.Email {
+				return nil
+			}
+			emailChanged = true
+
+			_, err = queries.GetUserByEmail(r.Context(), *params.Email)
+			if err == nil {
+				emailTaken = true
+			} else if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+
+			user, err = queries.SetPendingEmail(r.Context(), database.SetPendingEmailParams{
+				ID:           user.ID,
+				PendingEmail: sql.NullString{String: *params.Email, Valid: true},
+			})
+			return err
+		})
+		if isUniqueViolation(err, "users_handle_lower_idx") {
+			utils.RespondWithError(w, http.StatusConflict, "Handle already taken")
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondWithError(w, http.StatusNotFound, "User not found")
+			return
+		}
 		if err != nil {
-			log.Printf("Error hashing password: %v", err)
+			log.Printf("Error updating user: %v", err)
 			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
 			return
 		}
 
-		user, err := cfg.Queries.UpdateUser(
-			r.Context(),
-			database.UpdateUserParams{
-				ID:             userID,
-				Email:          params.Email,
-				HashedPassword: hashedPassword,
-			},
-		)
-		if err != nil {
-			log.Printf("Error updating user: %v", err)
+		// Taken addresses get the same response as free ones so this can't be
+		// used to find out who has an account. They never get a verification
+		// link, and verifying them would fail on the unique email anyway. The
+		// link can be sent again later, so failing to send it isn't fatal.
+		if emailChanged && !emailTaken {
+			err = sendEmailVerification(r, cfg, user.ID, *params.Email)
+			if err != nil {
+				log.Printf("Error sending email verification: %v", err)
+			}
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, newUser(user))
+	})
+}
+
+func getUserProfileHandler(cfg *config.ApiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleOrID := r.PathValue("handleOrID")
+
+		var user database.User
+		var err error
+		if id, parseErr := uuid.Parse(handleOrID); parseErr == nil {
+			user, err = cfg.Queries.GetUserByID(r.Context(), id)
+		} else {
+			user, err = cfg.Queries.GetUserByHandle(r.Context(), utils.NormalizeHandle(handleOrID))
+		}
+		if errors.Is(err, sql.ErrNoRows) {
 			utils.RespondWithError(w, http.StatusNotFound, "User not found")
 			return
 		}
+		if err != nil {
+			log.Printf("Error getting user: %v", err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
 
-		utils.RespondWithJSON(w, http.StatusOK, User{
+		utils.RespondWithJSON(w, http.StatusOK, PublicProfile{
 			ID:          user.ID,
 			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
-			Email:       user.Email,
+			Handle:      nullStringPtr(user.Handle),
+			DisplayName: user.DisplayName,
+			Bio:         user.Bio,
 			IsChirpyRed: user.IsChirpyRed,
 		})
 	})